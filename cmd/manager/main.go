@@ -12,6 +12,8 @@ import (
 	"k8s.io/client-go/rest"
 
 	"github.com/wingsofovnia/metrics-webhook/pkg/apis"
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
 	"github.com/wingsofovnia/metrics-webhook/pkg/controller"
 	"github.com/wingsofovnia/metrics-webhook/version"
 
@@ -25,18 +27,14 @@ import (
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
 
-// Change below variables to serve metrics on different host or port.
-var (
-	metricsHost               = "0.0.0.0"
-	metricsPort         int32 = 8383
-	operatorMetricsPort int32 = 8686
-)
 var log = logf.Log.WithName("cmd")
 
 func printVersion() {
@@ -55,6 +53,9 @@ func main() {
 	// controller-runtime)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
+	// Add the operator configuration flags, overriding the --config file
+	operatorFlags := configv1alpha1.NewFlags(pflag.CommandLine)
+
 	pflag.Parse()
 
 	// Use a zap logr.Logger implementation. If none of the zap
@@ -69,12 +70,22 @@ func main() {
 
 	printVersion()
 
-	namespace, err := k8sutil.GetWatchNamespace()
+	operatorConfig, err := operatorFlags.Complete()
 	if err != nil {
-		log.Error(err, "Failed to get watch namespace")
+		log.Error(err, "Failed to load operator config")
 		os.Exit(1)
 	}
 
+	namespaces := operatorConfig.WatchNamespaces
+	if len(namespaces) == 0 {
+		namespace, err := k8sutil.GetWatchNamespace()
+		if err != nil {
+			log.Error(err, "Failed to get watch namespace")
+			os.Exit(1)
+		}
+		namespaces = []string{namespace}
+	}
+
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -83,19 +94,37 @@ func main() {
 	}
 
 	ctx := context.TODO()
-	// Become the leader before proceeding
-	err = leader.Become(ctx, "metrics-webhook-lock")
-	if err != nil {
-		log.Error(err, "")
-		os.Exit(1)
+	leaderElection := operatorConfig.LeaderElection
+	// Become the leader before proceeding, the manager elects one itself in Lease mode
+	if leaderElection.LeaderElect && leaderElection.Mode == configv1alpha1.LeaderForLifeMode {
+		err = leader.Become(ctx, leaderElection.LockName)
+		if err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
 	}
 
-	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
+	options := manager.Options{
 		MapperProvider:     restmapper.NewDynamicRESTMapper,
-		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
-	})
+		MetricsBindAddress: fmt.Sprintf("%s:%d", operatorConfig.Metrics.Host, operatorConfig.Metrics.Port),
+		Port:               operatorConfig.Webhook.Port,
+	}
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	if leaderElection.LeaderElect && leaderElection.Mode == configv1alpha1.LeaseMode {
+		options.LeaderElection = true
+		options.LeaderElectionID = leaderElection.LockName
+		options.LeaderElectionNamespace = leaderElection.Namespace
+		options.LeaseDuration = &leaderElection.LeaseDuration.Duration
+		options.RenewDeadline = &leaderElection.RenewDeadline.Duration
+		options.RetryPeriod = &leaderElection.RetryPeriod.Duration
+	}
+
+	// Create a new Cmd to provide shared dependencies and start components
+	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -110,16 +139,26 @@ func main() {
 	}
 
 	// Setup all Controllers
-	if err := controller.AddToManager(mgr); err != nil {
+	if err := controller.AddToManager(mgr, operatorConfig); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
 
-	if err = serveCRMetrics(cfg); err != nil {
+	// Setup admission webhooks, disable to run the operator locally without serving certificates.
+	// ENABLE_WEBHOOKS=false is still honored for backward compatibility.
+	if operatorConfig.Enabled(configv1alpha1.AdmissionWebhooks) && os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := builder.WebhookManagedBy(mgr).For(&metricsv1alpha1.MetricWebhook{}).Complete(); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
+	if err = serveCRMetrics(cfg, operatorConfig.Metrics); err != nil {
 		log.Info("Could not generate and serve custom resource metrics", "error", err.Error())
 	}
 
 	// Add to the below struct any other metrics ports you want to expose.
+	metricsPort, operatorMetricsPort := operatorConfig.Metrics.Port, operatorConfig.Metrics.CRMetricsPort
 	servicePorts := []v1.ServicePort{
 		{Port: metricsPort, Name: metrics.OperatorPortName, Protocol: v1.ProtocolTCP, TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: metricsPort}},
 		{Port: operatorMetricsPort, Name: metrics.CRPortName, Protocol: v1.ProtocolTCP, TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: operatorMetricsPort}},
@@ -132,8 +171,13 @@ func main() {
 
 	// CreateServiceMonitors will automatically create the prometheus-operator ServiceMonitor resources
 	// necessary to configure Prometheus to scrape metrics from this operator.
+	// The metrics Service is created in the operator namespace, which may be none of the watched ones.
 	services := []*v1.Service{service}
-	_, err = metrics.CreateServiceMonitors(cfg, namespace, services)
+	serviceMonitorNamespace := namespaces[0]
+	if service != nil {
+		serviceMonitorNamespace = service.Namespace
+	}
+	_, err = metrics.CreateServiceMonitors(cfg, serviceMonitorNamespace, services)
 	if err != nil {
 		log.Info("Could not create ServiceMonitor object", "error", err.Error())
 		// If this operator is deployed to a cluster without the prometheus-operator running, it will return
@@ -153,8 +197,8 @@ func main() {
 }
 
 // serveCRMetrics gets the Operator/CustomResource GVKs and generates metrics based on those types.
-// It serves those metrics on "http://metricsHost:operatorMetricsPort".
-func serveCRMetrics(cfg *rest.Config) error {
+// It serves those metrics on "http://metricsConfig.Host:metricsConfig.CRMetricsPort".
+func serveCRMetrics(cfg *rest.Config, metricsConfig configv1alpha1.MetricsConfig) error {
 	// Below function returns filtered operator/CustomResource specific GVKs.
 	// For more control override the below GVK list with your own custom logic.
 	filteredGVK, err := k8sutil.GetGVKsFromAddToScheme(apis.AddToScheme)
@@ -169,7 +213,7 @@ func serveCRMetrics(cfg *rest.Config) error {
 	// To generate metrics in other namespaces, add the values below.
 	ns := []string{operatorNs}
 	// Generate and serve custom resource specific metrics.
-	err = kubemetrics.GenerateAndServeCRMetrics(cfg, ns, filteredGVK, metricsHost, operatorMetricsPort)
+	err = kubemetrics.GenerateAndServeCRMetrics(cfg, ns, filteredGVK, metricsConfig.Host, metricsConfig.CRMetricsPort)
 	if err != nil {
 		return err
 	}
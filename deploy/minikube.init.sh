@@ -9,8 +9,13 @@ eval $(minikube docker-env --unset)
 kubectl create -f deploy/service_account.yaml
 kubectl create -f deploy/role.yaml
 kubectl create -f deploy/role_binding.yaml
+kubectl create -f deploy/cluster_role.yaml
+kubectl create -f deploy/cluster_role_binding.yaml
 
 kubectl create -f deploy/crds/metrics.wingsofovnia.github.com_metricwebhooks_crd.yaml
+kubectl create -f deploy/webhook.yaml
+kubectl create -f deploy/operator_config.yaml
 kubectl create -f deploy/operator.yaml
+kubectl create -f deploy/stream_service.yaml
 
 cd "$OLDPWD" || exit
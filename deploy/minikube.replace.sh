@@ -11,6 +11,7 @@ kubectl replace --force -f deploy/role.yaml
 kubectl replace --force -f deploy/role_binding.yaml
 
 kubectl replace --force -f deploy/crds/metrics.wingsofovnia.github.com_metricwebhooks_crd.yaml
+kubectl replace --force -f deploy/operator_config.yaml
 kubectl replace --force -f deploy/operator.yaml
 
 cd "$OLDPWD" || exit
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/wingsofovnia/metrics-webhook/lib"
-	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -16,7 +20,7 @@ type GorandServer struct {
 	randChars int32
 }
 
-func NewGorandServer(addr string, randChars int32) *GorandServer {
+func NewGorandServer(addr string, randChars int32, registry *prometheus.Registry) *GorandServer {
 	router := http.NewServeMux()
 	server := &GorandServer{
 		server: &http.Server{
@@ -27,11 +31,12 @@ func NewGorandServer(addr string, randChars int32) *GorandServer {
 	}
 
 	router.HandleFunc("/", server.writeRand)
+	router.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	return server
 }
 
 func NewDefaultLoremServer() *GorandServer {
-	return NewGorandServer(":8080", math.MaxInt16)
+	return NewGorandServer(":8080", math.MaxInt16, prometheus.NewRegistry())
 }
 
 func (l *GorandServer) ListenAndServe() error {
@@ -41,7 +46,15 @@ func (l *GorandServer) ListenAndServe() error {
 
 func (l *GorandServer) writeRand(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	fmt.Fprintln(w, RandString(l.randChars))
+	fmt.Fprintln(w, RandString(l.RandChars()))
+}
+
+func (l *GorandServer) RandChars() int32 {
+	return atomic.LoadInt32(&l.randChars)
+}
+
+func (l *GorandServer) SetRandChars(randChars int32) {
+	atomic.StoreInt32(&l.randChars, randChars)
 }
 
 const randCharsConfig = "RAND_CHARS"
@@ -51,61 +64,51 @@ const randCharsFallbackAdj = -2457
 
 const correlatorBufferFlushCap = 3
 const correlatorOvershoot = 0.1
+const correlatorMinSamples = 3
+const correlatorMaxRelativeError = 0.5
 
 func main() {
-	log.Infof("Gorand config: {init = %d, min = %d, fallback = %d, correlator.buffercap = %d, correlator.overshoot = %.2f}",
-		randCharsInit, randCharsMin, randCharsFallbackAdj, correlatorBufferFlushCap, correlatorOvershoot)
+	log.Infof("Gorand config: {init = %d, min = %d, fallback = %d, correlator.buffercap = %d, correlator.overshoot = %.2f, correlator.minsamples = %d, correlator.maxrelerr = %.2f}",
+		randCharsInit, randCharsMin, randCharsFallbackAdj, correlatorBufferFlushCap, correlatorOvershoot, correlatorMinSamples, correlatorMaxRelativeError)
+
+	// Adaptation loop metrics, exposed on /metrics of the gorand server
+	registry := prometheus.NewRegistry()
+	metrics := lib.NewMetrics("gorand")
+	registry.MustRegister(metrics)
 
 	// Random string generator server
-	server := NewGorandServer(":8080", randCharsInit)
+	server := NewGorandServer(":8080", randCharsInit, registry)
 
 	// Adjustment SDK
-	correlator, _ := lib.NewAdjustmentCorrelator(3, 0.10)
-	var alertCallback = func(report v1alpha1.MetricReport) {
-		adjustments := make(lib.Adjustments)
-
-		if server.randChars <= randCharsMin {
-			log.Warnf("Gorand reached the lower possible randChar config, no adjustments applied")
-			return
-		}
-
-		log.Infof("Incoming notifications: %s", report.String())
-
-		if report.HasAlerts() {
-			suggestions := correlator.SuggestAdjustments(report)
-
-			if loremSuggestion, set := suggestions[randCharsConfig]; set {
-				log.Infof("Correlator suggests %s = %f", randCharsConfig, loremSuggestion)
-				adjustments[randCharsConfig] = loremSuggestion
-			} else {
-				log.Infof("Correlator gave no suggestions, default adjustment %s = %d", randCharsConfig, randCharsFallbackAdj)
-				adjustments[randCharsConfig] = float64(randCharsFallbackAdj)
-			}
-
-			prevLoremChars := server.randChars
-			server.randChars = max(randCharsMin, server.randChars + int32(adjustments[randCharsConfig]))
-
-			log.Infof("%s has been adjusted (was = %d, adjustment = %f, now = %d)",
-				randCharsConfig, prevLoremChars, adjustments[randCharsConfig], server.randChars)
-		} else {
-			log.Infoln("No alerts present, no adjustments has been made.")
-		}
+	controllerConfig := lib.DefaultControllerConfig()
+	controllerConfig.AdjustmentsBufferFlushCap = correlatorBufferFlushCap
+	controllerConfig.Overshoot = correlatorOvershoot
+	controllerConfig.MinSamples = correlatorMinSamples
+	controllerConfig.MaxRelativeError = correlatorMaxRelativeError
+	controllerConfig.Logger = lib.NewStdLogger(1) // log reports and suggestions too
+	controllerConfig.Metrics = metrics
+	controller, err := lib.NewController(controllerConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		correlator.RegisterAdjustments(report, adjustments)
+	randChars := lib.IntTunable(randCharsConfig,
+		func() int64 { return int64(server.RandChars()) },
+		func(v int64) { server.SetRandChars(int32(v)) })
+	randChars.Min = randCharsMin
+	randChars.Max = randCharsInit
+	randChars.Preferred = func(f float64) *float64 { return &f }(randCharsInit)
+	randChars.DefaultStep = randCharsFallbackAdj
+	if err := controller.Register(randChars); err != nil {
+		log.Fatal(err)
 	}
 
-	// Metrics Webhook server
-	webhookServer := lib.NewWebhookServer(alertCallback)
+	// Metrics Webhook server, coalesces callbacks so that only one adjusts randChars at a time
 	go func() {
-		webhookServer.ListenAndServe()
+		if err := controller.Serve(context.Background()); err != nil {
+			log.Fatalf("Metrics webhook server failed: %v", err)
+		}
 	}()
 
 	server.ListenAndServe()
 }
-
-func max(a, b int32) int32 {
-	if a > b {
-		return a
-	}
-	return b
-}
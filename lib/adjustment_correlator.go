@@ -2,6 +2,11 @@ package lib
 
 import (
 	"fmt"
+	"math"
+	"sync"
+
+	"github.com/go-logr/logr"
+
 	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
 )
 
@@ -19,16 +24,28 @@ type AdjustmentRound struct {
 	Adjustments  Adjustments
 }
 
+// AdjustmentCorrelator learns how Config adjustments improve metrics
+// and suggests adjustments for metric reports. It is safe for concurrent use.
 type AdjustmentCorrelator struct {
+	mu sync.Mutex
+
 	adjustmentsBuffer         []AdjustmentRound
 	adjustmentsBufferFlushCap int
 
-	overshoot float64
+	overshoot      float64
+	recoveryMargin float64
 
 	averageCorrelations AverageCorrelations
+
+	configConstraints map[Config]ConfigConstraints
+
+	logger    logr.Logger
+	logLevels LogLevels
+	metrics   *Metrics
 }
 
 const defaultOvershoot = 0.10
+const defaultRecoveryMargin = 0.10
 const minAdjustmentsBufferFlushCap = 3
 
 func NewAdjustmentCorrelator(adjustmentsBufferFlushCap int, overshoot float64) (*AdjustmentCorrelator, error) {
@@ -40,6 +57,10 @@ func NewAdjustmentCorrelator(adjustmentsBufferFlushCap int, overshoot float64) (
 		adjustmentsBufferFlushCap: adjustmentsBufferFlushCap,
 		averageCorrelations:       make(AverageCorrelations),
 		overshoot:                 overshoot,
+		recoveryMargin:            defaultRecoveryMargin,
+		configConstraints:         make(map[Config]ConfigConstraints),
+		logger:                    NewStdLogger(0).WithName("correlator"),
+		logLevels:                 DefaultLogLevels(),
 	}, nil
 }
 
@@ -48,19 +69,121 @@ func NewDefaultAdjustmentCorrelator() *AdjustmentCorrelator {
 	return c
 }
 
+// SetLogger sets the logger for suggestions and learned correlations,
+// logged at the Suggestions level
+func (c *AdjustmentCorrelator) SetLogger(logger logr.Logger, levels LogLevels) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logger = logger
+	c.logLevels = levels
+}
+
+// SetMetrics sets the collectors recording suggestions and learned
+// correlations, nil disables instrumentation
+func (c *AdjustmentCorrelator) SetMetrics(metrics *Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = metrics
+}
+
+// SetRecoveryMargin sets the fraction of metric targets to be kept free when
+// suggesting to restore Configs, e.g. 0.1 keeps metrics below 90% of their targets.
+func (c *AdjustmentCorrelator) SetRecoveryMargin(margin float64) error {
+	if margin < 0 || margin >= 1 {
+		return fmt.Errorf("recovery margin must be in [0, 1) interval")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recoveryMargin = margin
+	return nil
+}
+
+// RegisterConfig declares the feasible values of a Config so that suggestions
+// for it are kept within them. The current value of the config is then kept
+// track of by adding up the adjustments registered with RegisterAdjustments.
+func (c *AdjustmentCorrelator) RegisterConfig(config Config, constraints ConfigConstraints) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := constraints.validate(); err != nil {
+		return fmt.Errorf("invalid constraints of config %s: %v", config, err)
+	}
+	c.configConstraints[config] = constraints
+	return nil
+}
+
+// SetConfigValue updates the current value of a registered Config, e.g. if it
+// has been changed by other means than the registered adjustments.
+func (c *AdjustmentCorrelator) SetConfigValue(config Config, value float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	constraints, registered := c.configConstraints[config]
+	if !registered {
+		return fmt.Errorf("config %s is not registered", config)
+	}
+	constraints.Current = value
+	if err := constraints.validate(); err != nil {
+		return fmt.Errorf("invalid value of config %s: %v", config, err)
+	}
+	c.configConstraints[config] = constraints
+	return nil
+}
+
+// ConstrainAdjustment limits an adjustment of a Config to its registered
+// constraints, see ConfigConstraints.Constrain. Adjustments of configs
+// not registered are returned as is.
+func (c *AdjustmentCorrelator) ConstrainAdjustment(config Config, adjustment float64) (float64, Bound) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.constrainAdjustment(config, adjustment)
+}
+
+func (c *AdjustmentCorrelator) constrainAdjustment(config Config, adjustment float64) (float64, Bound) {
+	constraints, registered := c.configConstraints[config]
+	if !registered {
+		return adjustment, NoBound
+	}
+	return constraints.Constrain(adjustment)
+}
+
 func (c *AdjustmentCorrelator) RegisterAdjustments(report v1alpha1.MetricReport, appliedAdjustments Adjustments) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	reportedMeasurements := make(Measurements)
 	for _, m := range report {
+		if !m.HasData() {
+			// The values of metrics failed to be fetched are outdated
+			continue
+		}
 		reportedMeasurements[m.Name] = NewMeasurement(m.CurrentAverageValue, m.CurrentAverageUtilization)
 	}
+	// Copy adjustments so that the caller can reuse its map
+	roundAdjustments := make(Adjustments, len(appliedAdjustments))
+	for config, adjustment := range appliedAdjustments {
+		roundAdjustments[config] = adjustment
+	}
 	c.adjustmentsBuffer = append(c.adjustmentsBuffer, AdjustmentRound{
 		Measurements: reportedMeasurements,
-		Adjustments:  appliedAdjustments,
+		Adjustments:  roundAdjustments,
 	})
 
+	for config, adjustment := range appliedAdjustments {
+		if constraints, registered := c.configConstraints[config]; registered {
+			constraints.Current = constraints.Current + adjustment
+			c.configConstraints[config] = constraints
+		}
+	}
+
 	if c.adjustmentsBufferFlushCap >= minAdjustmentsBufferFlushCap &&
 		len(c.adjustmentsBuffer) >= c.adjustmentsBufferFlushCap {
-		c.Recorrelate()
+		c.recorrelate()
 	}
 }
 
@@ -111,6 +234,13 @@ func (c *AdjustmentCorrelator) RegisterAdjustments(report v1alpha1.MetricReport,
 //			"ram improvement":	-2.5  ((-2.5 + -2.5) / 2),
 //		},
 func (c *AdjustmentCorrelator) Recorrelate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recorrelate()
+}
+
+func (c *AdjustmentCorrelator) recorrelate() {
 	if len(c.adjustmentsBuffer) < c.adjustmentsBufferFlushCap {
 		return
 	}
@@ -128,7 +258,11 @@ func (c *AdjustmentCorrelator) Recorrelate() {
 		// Stage 1: [roundAdjustments] -> [roundImprovements]
 		roundImprovements := make(Measurements)
 		for metric, prevMeasurement := range prevRound.Measurements {
-			currMeasurement := currRound.Measurements[metric]
+			currMeasurement, measured := currRound.Measurements[metric]
+			if !measured {
+				// Not reported since, e.g. withdrawn or failed to be fetched
+				continue
+			}
 			roundImprovements[metric] = prevMeasurement.Sub(currMeasurement)
 		}
 
@@ -163,13 +297,74 @@ func (c *AdjustmentCorrelator) Recorrelate() {
 			} else {
 				c.averageCorrelations[config][metric] = NewAverageMeasurement(improvements...)
 			}
+
+			correlation := c.averageCorrelations[config][metric]
+			c.logger.V(c.logLevels.Suggestions).Info("recorrelated adjustments",
+				"config", config,
+				"metric", metric,
+				"valueImprovement", correlation.Value.Value,
+				"utilizationImprovement", correlation.Value.Utilization,
+				"samples", correlation.Among,
+			)
+			c.metrics.observeCorrelation(config, metric, correlation)
 		}
 	}
 
 	c.adjustmentsBuffer = nil
 }
 
-func (c *AdjustmentCorrelator) SuggestAdjustments(metricsReported v1alpha1.MetricReport) Adjustments {
+// correlatedMetrics returns the metrics the config has been correlated with so far
+func (c *AdjustmentCorrelator) correlatedMetrics(config Config) []Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var metrics []Metric
+	for metric := range c.averageCorrelations[config] {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// SuggestAdjustments suggests how to change Configs so that alerting metrics
+// meet their targets, based on the correlations learned so far. If the report
+// has no alerts, it suggests how to restore Configs towards their preferred
+// values instead, keeping metrics below their targets by the recovery margin,
+// see SetRecoveryMargin. Each suggestion
+// carries the number of samples it is based on and its confidence interval,
+// see Suggestions.Confident to filter out the ones not trustworthy enough.
+// Suggestions for configs registered with RegisterConfig are feasible values
+// within their constraints, see Suggestion.BlockedBy.
+func (c *AdjustmentCorrelator) SuggestAdjustments(metricsReported v1alpha1.MetricReport) Suggestions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var suggestions Suggestions
+	if metricsReported.HasAlerts() {
+		suggestions = c.suggestDegradation(metricsReported)
+	} else {
+		suggestions = c.suggestRecovery(metricsReported)
+	}
+
+	for config, suggestion := range suggestions {
+		c.logger.V(c.logLevels.Suggestions).Info("suggested adjustment",
+			"config", config,
+			"value", suggestion.Value,
+			"desired", suggestion.Desired,
+			"samples", suggestion.Samples,
+			"lower", suggestion.Lower,
+			"upper", suggestion.Upper,
+			"blockedBy", suggestion.BlockedBy,
+			"recovery", suggestion.Recovery,
+		)
+		c.metrics.observeSuggestion(config, suggestion)
+	}
+	return suggestions
+}
+
+// suggestDegradation suggests how to change Configs so that alerting metrics
+// meet their targets, overshooting the improvement needed by the overshoot factor.
+func (c *AdjustmentCorrelator) suggestDegradation(metricsReported v1alpha1.MetricReport) Suggestions {
+
 	targetImprovements := make(Measurements)
 	for _, notification := range metricsReported {
 		if notification.Type != v1alpha1.Alert {
@@ -177,13 +372,12 @@ func (c *AdjustmentCorrelator) SuggestAdjustments(metricsReported v1alpha1.Metri
 		}
 
 		var utilizationImprovementNeeded float64
-		if notification.CurrentAverageUtilization != nil {
+		if notification.CurrentAverageUtilization != nil && notification.TargetAverageUtilization != nil {
 			utilizationImprovementNeeded = float64(*notification.CurrentAverageUtilization - *notification.TargetAverageUtilization)
 		}
 
 		var valueImprovementNeeded float64
 		if notification.TargetAverageValue != nil {
-			notification.CurrentAverageValue.DeepCopy()
 			valueImprovementNeeded = quantityAsFloat64(notification.CurrentAverageValue) - quantityAsFloat64(*notification.TargetAverageValue)
 		}
 
@@ -199,15 +393,140 @@ func (c *AdjustmentCorrelator) SuggestAdjustments(metricsReported v1alpha1.Metri
 		return nil
 	}
 
-	suggestions := make(Adjustments)
+	suggestions := make(Suggestions)
 	for config, correlations := range c.averageCorrelations {
 		for metric, metricIncImprovement := range correlations {
 			if targetImprovement, requested := targetImprovements[metric]; requested {
-				baseSuggestion := metricIncImprovement.Value.GoesInto(targetImprovement) / float64(len(correlations))
-				suggestions[config] = baseSuggestion + baseSuggestion * c.overshoot
+				scale := (1 + c.overshoot) / float64(len(correlations))
+				suggestion := newSuggestion(metricIncImprovement, targetImprovement, scale)
+				suggestion.Value, suggestion.BlockedBy = c.constrainAdjustment(config, suggestion.Desired)
+				suggestions[config] = suggestion
 			}
 		}
 	}
 
 	return suggestions
 }
+
+// suggestRecovery suggests how to move Configs that have a preferred value
+// registered back towards it, given the headroom metrics have below their targets.
+// The headroom is reduced by the recovery margin, so that metrics are expected
+// to stay below (1 - margin) * target after the adjustment. The headroom of a
+// metric is shared evenly by the Configs recovering at its expense. Every metric
+// a Config correlates with limits the recovery, so the most cautious suggestion wins.
+func (c *AdjustmentCorrelator) suggestRecovery(metricsReported v1alpha1.MetricReport) Suggestions {
+	headrooms := make(Measurements)
+	exhausted := make(map[Metric]bool)
+	for _, notification := range metricsReported {
+		if notification.IsBlind() {
+			// Recovering blindly may push the metric over its target unnoticed
+			exhausted[notification.Name] = true
+		}
+		if !notification.HasData() {
+			continue
+		}
+		var utilizationHeadroom float64
+		if notification.CurrentAverageUtilization != nil && notification.TargetAverageUtilization != nil {
+			allowedUtilization := float64(*notification.TargetAverageUtilization) * (1 - c.recoveryMargin)
+			utilizationHeadroom = allowedUtilization - float64(*notification.CurrentAverageUtilization)
+			if utilizationHeadroom <= 0 {
+				exhausted[notification.Name] = true
+				continue
+			}
+		}
+
+		var valueHeadroom float64
+		if notification.TargetAverageValue != nil {
+			allowedValue := quantityAsFloat64(*notification.TargetAverageValue) * (1 - c.recoveryMargin)
+			valueHeadroom = allowedValue - quantityAsFloat64(notification.CurrentAverageValue)
+			if valueHeadroom <= 0 {
+				exhausted[notification.Name] = true
+				continue
+			}
+		}
+
+		if utilizationHeadroom > 0 || valueHeadroom > 0 {
+			// Headroom is an improvement the metric can afford to lose
+			headrooms[notification.Name] = Measurement{
+				Value:       -valueHeadroom,
+				Utilization: -utilizationHeadroom,
+			}
+		}
+	}
+
+	if len(headrooms) == 0 {
+		return nil
+	}
+
+	// Find the Configs to recover and how many of them spend each metric's headroom
+	recovering := make(map[Config]float64)
+	sharing := make(map[Metric]int)
+	for config, correlations := range c.averageCorrelations {
+		constraints, registered := c.configConstraints[config]
+		if !registered || constraints.Preferred == nil || *constraints.Preferred == constraints.Current {
+			continue
+		}
+		towardsPreferred := *constraints.Preferred - constraints.Current
+
+		var spent []Metric
+		blocked := false
+		for metric, metricIncImprovement := range correlations {
+			if exhausted[metric] {
+				blocked = true
+				break
+			}
+			headroom, reported := headrooms[metric]
+			if reported && spendsHeadroom(newSuggestion(metricIncImprovement, headroom, 1), towardsPreferred) {
+				spent = append(spent, metric)
+			}
+		}
+		if blocked || len(spent) == 0 {
+			continue
+		}
+		recovering[config] = towardsPreferred
+		for _, metric := range spent {
+			sharing[metric]++
+		}
+	}
+
+	suggestions := make(Suggestions)
+	for config, towardsPreferred := range recovering {
+		constraints := c.configConstraints[config]
+
+		var cautious *Suggestion
+		for metric, metricIncImprovement := range c.averageCorrelations[config] {
+			headroom, reported := headrooms[metric]
+			if !reported || sharing[metric] == 0 {
+				// No headroom or not spent by any Config
+				continue
+			}
+
+			suggestion := newSuggestion(metricIncImprovement, headroom, 1.0/float64(sharing[metric]))
+			if !spendsHeadroom(suggestion, towardsPreferred) {
+				continue
+			}
+			if cautious == nil || math.Abs(suggestion.Desired) < math.Abs(cautious.Desired) {
+				cautious = &suggestion
+			}
+		}
+		if cautious == nil {
+			continue
+		}
+
+		adjustment := cautious.Desired
+		if math.Abs(adjustment) > math.Abs(towardsPreferred) {
+			adjustment = towardsPreferred
+		}
+		cautious.Value, cautious.BlockedBy = constraints.constrain(adjustment, false)
+		cautious.Recovery = true
+		suggestions[config] = *cautious
+	}
+
+	return suggestions
+}
+
+// spendsHeadroom tells whether moving towards the preferred value worsens the
+// metric the suggestion has been made for, otherwise the metric does not limit it
+func spendsHeadroom(suggestion Suggestion, towardsPreferred float64) bool {
+	return suggestion.Desired != 0 && math.Signbit(suggestion.Desired) == math.Signbit(towardsPreferred)
+}
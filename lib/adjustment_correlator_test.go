@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"math"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -101,6 +103,28 @@ func TestAdjustmentCorrelator_Recorrelate(t *testing.T) {
 		0.1)
 }
 
+func TestAdjustmentCorrelator_Recorrelate_Unmeasured(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(-1, 0.0)
+	assert.NoError(t, err)
+
+	cpu := func(utilization int32) v1alpha1.MetricNotification {
+		return v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(utilization),
+		}
+	}
+	correlator.RegisterAdjustments(v1alpha1.MetricReport{cpu(100)}, Adjustments{"quality": -5})
+	// cpu is not measured in the next round, e.g. withdrawn
+	correlator.RegisterAdjustments(nil, Adjustments{"pages": -2})
+	correlator.RegisterAdjustments(v1alpha1.MetricReport{cpu(50)}, Adjustments{})
+	correlator.Recorrelate()
+
+	// Missing measurements are not taken for an improvement down to 0
+	assert.Empty(t, correlator.averageCorrelations["quality"])
+	assert.Empty(t, correlator.averageCorrelations["pages"])
+}
+
 func TestAdjustmentCorrelator_Recorrelate_Multiple(t *testing.T) {
 	correlator, err := NewAdjustmentCorrelator(-1, 0.0) // cap < 1 ~ manual Recorrelation()
 	assert.NoError(t, err)
@@ -328,6 +352,302 @@ func TestAdjustmentCorrelator_SuggestAdjustments(t *testing.T) {
 	})
 
 	// Should suggest exactly the adjustments that was applied in the same situation
-	assert.InDelta(t, -5.0, suggestions["quality"], 0.1)
-	assert.InDelta(t, -5.0, suggestions["pages"], 0.1)
+	assert.InDelta(t, -5.0, suggestions["quality"].Value, 0.1)
+	assert.InDelta(t, -5.0, suggestions["pages"].Value, 0.1)
+
+	// Learned from a single round only, so no confidence can be given
+	assert.Equal(t, 1, suggestions["quality"].Samples)
+	assert.True(t, math.IsInf(suggestions["quality"].Lower, -1))
+	assert.True(t, math.IsInf(suggestions["quality"].Upper, 1))
+	assert.Empty(t, suggestions.Confident(2, math.Inf(1)))
+	assert.Len(t, suggestions.Adjustments(), 2)
+}
+
+func TestAdjustmentCorrelator_SuggestAdjustments_Confidence(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(-1, 0.0) // cap < 1 ~ manual Recorrelation()
+	assert.NoError(t, err)
+
+	// Three rounds of -5 adjustments with slightly different outcomes: 50, 40, 60
+	for _, improvement := range []int32{50, 40, 60} {
+		correlator.RegisterAdjustments(
+			v1alpha1.MetricReport{
+				v1alpha1.MetricNotification{
+					Type:                      v1alpha1.Alert,
+					Name:                      "cpu",
+					CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+				},
+			}, Adjustments{
+				"quality": float64(-5),
+			})
+		correlator.RegisterAdjustments(
+			v1alpha1.MetricReport{
+				v1alpha1.MetricNotification{
+					Type:                      v1alpha1.Alert,
+					Name:                      "cpu",
+					CurrentAverageUtilization: func(i int32) *int32 { return &i }(100 - improvement),
+				},
+			}, Adjustments{})
+	}
+	correlator.Recorrelate()
+
+	assert.Equal(t, 3, correlator.averageCorrelations["quality"]["cpu"].Among)
+
+	suggestions := correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	})
+
+	suggestion := suggestions["quality"]
+	assert.Equal(t, 3, suggestion.Samples)
+	assert.InDelta(t, -5.0, suggestion.Value, 0.1)
+	assert.Greater(t, suggestion.Variance, 0.0)
+	assert.Less(t, suggestion.Lower, suggestion.Value)
+	assert.Greater(t, suggestion.Upper, suggestion.Value)
+	assert.False(t, math.IsInf(suggestion.RelativeError(), 1))
+
+	assert.Contains(t, suggestions.Confident(3, suggestion.RelativeError()), "quality")
+	assert.NotContains(t, suggestions.Confident(4, suggestion.RelativeError()), "quality")
+	assert.NotContains(t, suggestions.Confident(3, suggestion.RelativeError()/2), "quality")
+}
+
+func TestAdjustmentCorrelator_SuggestAdjustments_Constrained(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(-1, 0.0) // cap < 1 ~ manual Recorrelation()
+	assert.NoError(t, err)
+
+	assert.Error(t, correlator.RegisterConfig("quality", ConfigConstraints{Min: 10, Max: 0}))
+	assert.NoError(t, correlator.RegisterConfig("quality", ConfigConstraints{
+		Min:     0,
+		Max:     20,
+		Current: 20,
+		Integer: true,
+	}))
+
+	// -5 adjustment improves cpu by 50, quality is now 15
+	correlator.RegisterAdjustments(
+		v1alpha1.MetricReport{
+			v1alpha1.MetricNotification{
+				Type:                      v1alpha1.Alert,
+				Name:                      "cpu",
+				CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			},
+		}, Adjustments{
+			"quality": float64(-5),
+		})
+	correlator.RegisterAdjustments(
+		v1alpha1.MetricReport{
+			v1alpha1.MetricNotification{
+				Type:                      v1alpha1.Alert,
+				Name:                      "cpu",
+				CurrentAverageUtilization: func(i int32) *int32 { return &i }(50),
+			},
+		}, Adjustments{})
+	correlator.Recorrelate()
+
+	// Improving cpu by 75 needs -7.5 quality, which is rounded to -8
+	suggestions := correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(25),
+		},
+	})
+	assert.InDelta(t, -7.5, suggestions["quality"].Desired, 0.01)
+	assert.Equal(t, -8.0, suggestions["quality"].Value)
+	assert.False(t, suggestions["quality"].Blocked())
+
+	// Improving cpu by 200 needs -20 quality, but only 15 is left
+	suggestions = correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(250),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	})
+	assert.InDelta(t, -20.0, suggestions["quality"].Desired, 0.01)
+	assert.Equal(t, -15.0, suggestions["quality"].Value)
+	assert.Equal(t, MinBound, suggestions["quality"].BlockedBy)
+
+	assert.NoError(t, correlator.SetConfigValue("quality", 0))
+	adjustment, bound := correlator.ConstrainAdjustment("quality", -1)
+	assert.Equal(t, 0.0, adjustment)
+	assert.Equal(t, MinBound, bound)
+
+	adjustment, bound = correlator.ConstrainAdjustment("unregistered", -1)
+	assert.Equal(t, -1.0, adjustment)
+	assert.Equal(t, NoBound, bound)
+}
+
+func TestAdjustmentCorrelator_Concurrent(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(minAdjustmentsBufferFlushCap, 0.0)
+	assert.NoError(t, err)
+
+	report := v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			correlator.SuggestAdjustments(report)
+			correlator.RegisterAdjustments(report, Adjustments{"quality": -1})
+		}()
+	}
+	wg.Wait()
+
+	assert.Contains(t, correlator.averageCorrelations, "quality")
+}
+
+func TestAdjustmentCorrelator_SuggestAdjustments_Recovery(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(-1, 0.0) // cap < 1 ~ manual Recorrelation()
+	assert.NoError(t, err)
+	assert.NoError(t, correlator.SetRecoveryMargin(0.2))
+
+	preferredQuality := float64(20)
+	assert.NoError(t, correlator.RegisterConfig("quality", ConfigConstraints{
+		Min:       0,
+		Max:       20,
+		Current:   20,
+		Integer:   true,
+		Preferred: &preferredQuality,
+	}))
+
+	// -5 quality improves cpu by 50, quality is now 15
+	correlator.RegisterAdjustments(
+		v1alpha1.MetricReport{
+			v1alpha1.MetricNotification{
+				Type:                      v1alpha1.Alert,
+				Name:                      "cpu",
+				CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			},
+		}, Adjustments{
+			"quality": float64(-5),
+		})
+	correlator.RegisterAdjustments(
+		v1alpha1.MetricReport{
+			v1alpha1.MetricNotification{
+				Type:                      v1alpha1.Cooldown,
+				Name:                      "cpu",
+				CurrentAverageUtilization: func(i int32) *int32 { return &i }(50),
+			},
+		}, Adjustments{})
+	correlator.Recorrelate()
+
+	// cpu may grow by 80 * (1 - 0.2) - 40 = 24, that is +2.4 quality rounded down
+	suggestions := correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(40),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(80),
+		},
+	})
+	assert.True(t, suggestions["quality"].Recovery)
+	assert.InDelta(t, 2.4, suggestions["quality"].Desired, 0.01)
+	assert.Equal(t, 2.0, suggestions["quality"].Value)
+
+	// Plenty of headroom, but never past the preferred value
+	suggestions = correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(1),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(100),
+		},
+	})
+	assert.Equal(t, 5.0, suggestions["quality"].Value)
+
+	// No headroom within the margin
+	suggestions = correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(70),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(80),
+		},
+	})
+	assert.NotContains(t, suggestions, "quality")
+
+	// No recovery while cpu cannot be fetched, even if its last value had headroom
+	suggestions = correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.NoData,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(1),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(100),
+		},
+	})
+	assert.NotContains(t, suggestions, "quality")
+
+	// Nothing to recover once at the preferred value
+	assert.NoError(t, correlator.SetConfigValue("quality", preferredQuality))
+	suggestions = correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(1),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(100),
+		},
+	})
+	assert.NotContains(t, suggestions, "quality")
+}
+
+func TestAdjustmentCorrelator_SuggestAdjustments_RecoveryShared(t *testing.T) {
+	correlator, err := NewAdjustmentCorrelator(-1, 0.0)
+	assert.NoError(t, err)
+	assert.NoError(t, correlator.SetRecoveryMargin(0.2))
+
+	preferred := float64(20)
+	for config, current := range map[Config]float64{"quality": 15, "pages": 15, "fonts": 20} {
+		assert.NoError(t, correlator.RegisterConfig(config, ConfigConstraints{
+			Min:       0,
+			Max:       20,
+			Current:   current,
+			Preferred: &preferred,
+		}))
+	}
+	// +1 quality worsens cpu by 10, +1 pages worsens cpu by 4 and memory by 1,
+	// fonts are at their preferred value already
+	correlator.averageCorrelations["quality"] = map[Metric]AverageMeasurement{
+		"cpu": NewAverageMeasurement(Measurement{Utilization: -10}),
+	}
+	correlator.averageCorrelations["pages"] = map[Metric]AverageMeasurement{
+		"cpu":    NewAverageMeasurement(Measurement{Utilization: -4}),
+		"memory": NewAverageMeasurement(Measurement{Utilization: -1}),
+	}
+	correlator.averageCorrelations["fonts"] = map[Metric]AverageMeasurement{
+		"cpu": NewAverageMeasurement(Measurement{Utilization: -1}),
+	}
+
+	// cpu may grow by 80 * (1 - 0.2) - 40 = 24 shared by quality and pages,
+	// memory by 80 - 10 = 70 spent by pages alone
+	suggestions := correlator.SuggestAdjustments(v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(40),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(80),
+		},
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "memory",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(10),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(100),
+		},
+	})
+	assert.InDelta(t, 1.2, suggestions["quality"].Desired, 0.01)
+	assert.InDelta(t, 3.0, suggestions["pages"].Desired, 0.01)
+	assert.NotContains(t, suggestions, "fonts")
 }
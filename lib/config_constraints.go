@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bound names a constraint that limited a suggested adjustment
+type Bound string
+
+const (
+	// NoBound means the adjustment has not been limited
+	NoBound Bound = ""
+	// MinBound means the adjustment would bring the config below its minimum
+	MinBound Bound = "Min"
+	// MaxBound means the adjustment would bring the config above its maximum
+	MaxBound Bound = "Max"
+	// MaxChangeBound means the adjustment exceeds the change allowed per round
+	MaxChangeBound Bound = "MaxChange"
+)
+
+// ConfigConstraints declares the feasible values of a Config. Use
+// math.Inf to leave Min or Max unbounded.
+type ConfigConstraints struct {
+	// Min is the lowest value the config can take
+	Min float64
+	// Max is the highest value the config can take
+	Max float64
+	// Current is the value the config has right now
+	Current float64
+	// Step is the granularity adjustments are rounded to, 0 disables rounding
+	Step float64
+	// Integer restricts the config to integer values only
+	Integer bool
+	// MaxChange limits the absolute adjustment per round, 0 disables the limit.
+	// It must allow at least one Step (and 1 if Integer is set)
+	MaxChange float64
+	// Preferred is the value the config is restored towards once metrics
+	// have headroom, nil disables recovery suggestions for the config
+	Preferred *float64
+}
+
+func (c ConfigConstraints) validate() error {
+	if math.IsNaN(c.Min) || math.IsNaN(c.Max) || math.IsNaN(c.Current) {
+		return fmt.Errorf("min, max and current must be numbers")
+	}
+	if c.Min > c.Max {
+		return fmt.Errorf("min (%f) must not be greater than max (%f)", c.Min, c.Max)
+	}
+	if c.Current < c.Min || c.Current > c.Max {
+		return fmt.Errorf("current (%f) must be within [%f, %f]", c.Current, c.Min, c.Max)
+	}
+	if c.Step < 0 {
+		return fmt.Errorf("step must not be negative")
+	}
+	if c.MaxChange < 0 {
+		return fmt.Errorf("max change must not be negative")
+	}
+	if c.MaxChange > 0 && c.MaxChange < c.Step {
+		// Adjustments limited by max change would be rounded down to nothing
+		return fmt.Errorf("max change (%f) must not be less than step (%f)", c.MaxChange, c.Step)
+	}
+	if c.MaxChange > 0 && c.MaxChange < 1 && c.Integer {
+		return fmt.Errorf("max change (%f) must be at least 1 for integer configs", c.MaxChange)
+	}
+	if c.Preferred != nil && (*c.Preferred < c.Min || *c.Preferred > c.Max) {
+		return fmt.Errorf("preferred (%f) must be within [%f, %f]", *c.Preferred, c.Min, c.Max)
+	}
+	return nil
+}
+
+// Constrain turns a desired adjustment into a feasible one. The adjustment
+// is rounded away from zero to Step (and to integers if Integer is set) so that
+// it achieves at least the improvement desired, then limited by MaxChange and
+// finally by Min and Max. The returned Bound tells which constraint, if any,
+// prevented the desired adjustment.
+func (c ConfigConstraints) Constrain(desired float64) (float64, Bound) {
+	return c.constrain(desired, true)
+}
+
+// constrain rounds the adjustment either away from zero, to achieve at least
+// the improvement desired, or towards zero, not to spend more than allowed.
+func (c ConfigConstraints) constrain(desired float64, awayFromZero bool) (float64, Bound) {
+	round := math.Trunc
+	if awayFromZero {
+		round = roundAwayFromZero
+	}
+
+	adjustment := desired
+	if c.Step > 0 {
+		adjustment = round(adjustment/c.Step) * c.Step
+	}
+	if c.Integer {
+		adjustment = round(adjustment)
+	}
+
+	bound := NoBound
+	if c.MaxChange > 0 && math.Abs(adjustment) > c.MaxChange {
+		maxChange := c.MaxChange
+		if c.Step > 0 {
+			maxChange = math.Floor(maxChange/c.Step) * c.Step
+		}
+		if c.Integer {
+			maxChange = math.Floor(maxChange)
+		}
+		adjustment = math.Copysign(maxChange, adjustment)
+		bound = MaxChangeBound
+	}
+
+	value := c.Current + adjustment
+	if value < c.Min {
+		value = c.Min
+		bound = MinBound
+	} else if value > c.Max {
+		value = c.Max
+		bound = MaxBound
+	}
+	if c.Integer && bound != NoBound && bound != MaxChangeBound {
+		// Bounds may not be integers themselves, stay within them
+		if value > c.Current {
+			value = math.Floor(value)
+		} else {
+			value = math.Ceil(value)
+		}
+	}
+
+	return value - c.Current, bound
+}
+
+func roundAwayFromZero(f float64) float64 {
+	if f < 0 {
+		return math.Floor(f)
+	}
+	return math.Ceil(f)
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigConstraints_Constrain(t *testing.T) {
+	constraints := ConfigConstraints{
+		Min:     10,
+		Max:     100,
+		Current: 50,
+	}
+
+	adjustment, bound := constraints.Constrain(-15.5)
+	assert.Equal(t, -15.5, adjustment)
+	assert.Equal(t, NoBound, bound)
+
+	adjustment, bound = constraints.Constrain(-45)
+	assert.Equal(t, -40.0, adjustment)
+	assert.Equal(t, MinBound, bound)
+
+	adjustment, bound = constraints.Constrain(60)
+	assert.Equal(t, 50.0, adjustment)
+	assert.Equal(t, MaxBound, bound)
+}
+
+func TestConfigConstraints_Constrain_StepAndInteger(t *testing.T) {
+	stepped := ConfigConstraints{
+		Min:     math.Inf(-1),
+		Max:     math.Inf(1),
+		Current: 0,
+		Step:    5,
+	}
+
+	// Rounded away from zero so that the improvement desired is achieved
+	adjustment, bound := stepped.Constrain(-11)
+	assert.Equal(t, -15.0, adjustment)
+	assert.Equal(t, NoBound, bound)
+
+	integer := ConfigConstraints{
+		Min:     0,
+		Max:     10.5,
+		Current: 9,
+		Integer: true,
+	}
+
+	adjustment, bound = integer.Constrain(-2.2)
+	assert.Equal(t, -3.0, adjustment)
+	assert.Equal(t, NoBound, bound)
+
+	// Bounds that are not integers are not crossed
+	adjustment, bound = integer.Constrain(5)
+	assert.Equal(t, 1.0, adjustment)
+	assert.Equal(t, MaxBound, bound)
+}
+
+func TestConfigConstraints_Constrain_MaxChange(t *testing.T) {
+	constraints := ConfigConstraints{
+		Min:       0,
+		Max:       100,
+		Current:   50,
+		Step:      3,
+		MaxChange: 10,
+	}
+
+	adjustment, bound := constraints.Constrain(-20)
+	assert.Equal(t, -9.0, adjustment)
+	assert.Equal(t, MaxChangeBound, bound)
+
+	adjustment, bound = constraints.Constrain(5)
+	assert.Equal(t, 6.0, adjustment)
+	assert.Equal(t, NoBound, bound)
+}
+
+func TestConfigConstraints_validate(t *testing.T) {
+	assert.NoError(t, ConfigConstraints{Min: 0, Max: 10, Current: 5}.validate())
+	assert.Error(t, ConfigConstraints{Min: 10, Max: 0, Current: 5}.validate())
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 11}.validate())
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, Step: -1}.validate())
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, MaxChange: -1}.validate())
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, Step: 2, MaxChange: 1}.validate())
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, Integer: true, MaxChange: 0.5}.validate())
+	assert.NoError(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, Step: 2, MaxChange: 2}.validate())
+
+	preferred := float64(20)
+	assert.Error(t, ConfigConstraints{Min: 0, Max: 10, Current: 5, Preferred: &preferred}.validate())
+}
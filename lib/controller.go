@@ -0,0 +1,425 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/rest"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Tunable is an application config the Controller adjusts in response
+// to metric reports
+type Tunable struct {
+	// Name identifies the tunable in the correlator
+	Name Config
+	// Get returns the current value of the tunable
+	Get func() float64
+	// Set applies a new value of the tunable
+	Set func(float64)
+
+	// Min and Max bound the values of the tunable, use math.Inf to leave unbounded
+	Min float64
+	Max float64
+	// Step is the granularity adjustments are rounded to, 0 disables rounding
+	Step float64
+	// Integer restricts the tunable to integer values only
+	Integer bool
+	// MaxChange limits the absolute adjustment per round, 0 disables the limit.
+	// It must allow at least one Step (and 1 if Integer is set)
+	MaxChange float64
+	// Preferred is the value the tunable is restored towards once metrics
+	// have headroom, nil disables recovery
+	Preferred *float64
+	// Safe is the value the tunable falls back to while the report misses
+	// current data of some metric, unless it is degraded further already
+	// (past Safe as seen from Preferred). Nil leaves the tunable as it is.
+	Safe *float64
+
+	// DefaultStep is the adjustment applied on alerts while the correlator
+	// has no confident suggestion yet, e.g. negative to lower a quality setting
+	DefaultStep float64
+	// Priority orders tunables for default steps, the ones with higher priority
+	// are stepped first and lower ones only after those reach their bounds
+	Priority int
+}
+
+// IntTunable creates an integer Tunable from typed getter and setter
+func IntTunable(name Config, get func() int64, set func(int64)) Tunable {
+	return Tunable{
+		Name:    name,
+		Get:     func() float64 { return float64(get()) },
+		Set:     func(v float64) { set(int64(math.Round(v))) },
+		Min:     math.Inf(-1),
+		Max:     math.Inf(1),
+		Integer: true,
+	}
+}
+
+// FloatTunable creates a Tunable from typed getter and setter
+func FloatTunable(name Config, get func() float64, set func(float64)) Tunable {
+	return Tunable{
+		Name: name,
+		Get:  get,
+		Set:  set,
+		Min:  math.Inf(-1),
+		Max:  math.Inf(1),
+	}
+}
+
+func (t Tunable) constraints() ConfigConstraints {
+	return ConfigConstraints{
+		Min:       t.Min,
+		Max:       t.Max,
+		Current:   t.Get(),
+		Step:      t.Step,
+		Integer:   t.Integer,
+		MaxChange: t.MaxChange,
+		Preferred: t.Preferred,
+	}
+}
+
+type ControllerConfig struct {
+	// Server configures the webhook server receiving metric reports
+	Server *WebhookServerConfig
+	// AdjustmentsBufferFlushCap and Overshoot configure the correlator,
+	// see NewAdjustmentCorrelator
+	AdjustmentsBufferFlushCap int
+	Overshoot                 float64
+	// RecoveryMargin is the fraction of metric targets kept free when
+	// restoring tunables, see AdjustmentCorrelator.SetRecoveryMargin
+	RecoveryMargin float64
+	// MinSamples and MaxRelativeError decide whether a suggestion is confident
+	// enough to be applied instead of the default steps, see Suggestions.Confident
+	MinSamples       int
+	MaxRelativeError float64
+	// Logger logs adjustments applied, suggestions and reports received,
+	// defaults to the standard log package
+	Logger logr.Logger
+	// LogLevels sets the verbosity of reports, suggestions and adjustments
+	LogLevels LogLevels
+	// Metrics records the reports, suggestions, adjustments and correlations
+	// of the controller, nil disables instrumentation
+	Metrics *Metrics
+}
+
+func DefaultControllerConfig() *ControllerConfig {
+	return &ControllerConfig{
+		Server:                    DefaultWebhookServerConfig(),
+		AdjustmentsBufferFlushCap: minAdjustmentsBufferFlushCap,
+		Overshoot:                 defaultOvershoot,
+		RecoveryMargin:            defaultRecoveryMargin,
+		MinSamples:                minAdjustmentsBufferFlushCap,
+		MaxRelativeError:          0.5,
+		LogLevels:                 DefaultLogLevels(),
+	}
+}
+
+// Controller closes the loop between metric reports and application tunables.
+// On alerts it applies confident correlator suggestions or, lacking those, the
+// default step of the highest priority tunable not yet at its bound. Once metrics
+// have headroom it restores tunables towards their preferred values, or right away
+// once the metrics they have been degraded for are withdrawn. Every applied
+// adjustment is registered back to the correlator so that it keeps learning.
+type Controller struct {
+	mu sync.Mutex
+
+	cfg        *ControllerConfig
+	logger     logr.Logger
+	correlator *AdjustmentCorrelator
+	server     *WebhookServer
+	tunables   []Tunable
+
+	// alerting are the metrics alerting as of the last reports, so that
+	// tunables are not restored while other metrics still need them degraded
+	alerting map[Metric]bool
+}
+
+func NewController(cfgs ...*ControllerConfig) (*Controller, error) {
+	var cfg *ControllerConfig
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = DefaultControllerConfig()
+	}
+
+	correlator, err := NewAdjustmentCorrelator(cfg.AdjustmentsBufferFlushCap, cfg.Overshoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := correlator.SetRecoveryMargin(cfg.RecoveryMargin); err != nil {
+		return nil, err
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewStdLogger(0)
+	}
+	correlator.SetLogger(logger.WithName("correlator"), cfg.LogLevels)
+	correlator.SetMetrics(cfg.Metrics)
+
+	serverCfg := DefaultWebhookServerConfig()
+	if cfg.Server != nil {
+		serverCfgCopy := *cfg.Server
+		serverCfg = &serverCfgCopy
+	}
+	if cfg.Logger != nil || serverCfg.Logger == nil {
+		serverCfg.Logger = logger.WithName("webhook")
+	}
+	handlerCfg := DefaultWebhookHandlerConfig()
+	if serverCfg.Handler != nil {
+		handlerCfgCopy := *serverCfg.Handler
+		handlerCfg = &handlerCfgCopy
+	}
+	handlerCfg.LogLevels = cfg.LogLevels
+	if handlerCfg.Metrics == nil {
+		handlerCfg.Metrics = cfg.Metrics
+	}
+	serverCfg.Handler = handlerCfg
+
+	controller := &Controller{
+		cfg:        cfg,
+		logger:     logger.WithName("controller"),
+		correlator: correlator,
+		alerting:   make(map[Metric]bool),
+	}
+	controller.server = NewWebhookServer(controller.Handle, serverCfg)
+	return controller, nil
+}
+
+// Register adds a tunable to be adjusted by the controller
+func (c *Controller) Register(tunable Tunable) error {
+	if tunable.Name == "" {
+		return fmt.Errorf("tunable name must be set")
+	}
+	if tunable.Get == nil || tunable.Set == nil {
+		return fmt.Errorf("tunable %s must have both getter and setter", tunable.Name)
+	}
+	if tunable.Safe != nil && (*tunable.Safe < tunable.Min || *tunable.Safe > tunable.Max) {
+		return fmt.Errorf("tunable %s safe value (%f) must be within [%f, %f]",
+			tunable.Name, *tunable.Safe, tunable.Min, tunable.Max)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, registered := range c.tunables {
+		if registered.Name == tunable.Name {
+			return fmt.Errorf("tunable %s is already registered", tunable.Name)
+		}
+	}
+	if err := c.correlator.RegisterConfig(tunable.Name, tunable.constraints()); err != nil {
+		return err
+	}
+
+	c.tunables = append(c.tunables, tunable)
+	sort.SliceStable(c.tunables, func(i, j int) bool {
+		return c.tunables[i].Priority > c.tunables[j].Priority
+	})
+	return nil
+}
+
+// Correlator exposes the correlator learning the effects of the adjustments
+func (c *Controller) Correlator() *AdjustmentCorrelator {
+	return c.correlator
+}
+
+// Handle is the Webhook callback adjusting tunables in response to the report
+func (c *Controller) Handle(ctx context.Context, report v1alpha1.MetricReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Tunables may have been changed by the application meanwhile
+	for _, tunable := range c.tunables {
+		if err := c.correlator.SetConfigValue(tunable.Name, tunable.Get()); err != nil {
+			c.logger.Error(err, "failed to sync tunable value", "tunable", tunable.Name)
+		}
+	}
+
+	for _, notification := range report {
+		switch notification.Type {
+		case v1alpha1.Alert:
+			c.alerting[notification.Name] = true
+		case v1alpha1.Cooldown, v1alpha1.Withdrawn:
+			delete(c.alerting, notification.Name)
+		}
+	}
+
+	if report.IsWithdrawn() {
+		c.restoreWithdrawn(report)
+		return
+	}
+	if report.HasMissingData() && c.applySafe(report) {
+		return
+	}
+
+	suggestions := c.correlator.SuggestAdjustments(report)
+	confident := suggestions.Confident(c.cfg.MinSamples, c.cfg.MaxRelativeError)
+
+	adjustments := make(Adjustments)
+	if report.HasAlerts() {
+		for _, tunable := range c.tunables {
+			if adjustment, set := confident[tunable.Name]; set && adjustment != 0 {
+				c.adjust(tunable, adjustment, suggestions[tunable.Name].BlockedBy, adjustments)
+			}
+		}
+
+		if len(adjustments) == 0 {
+			for _, tunable := range c.tunables {
+				adjustment, blockedBy := c.correlator.ConstrainAdjustment(tunable.Name, tunable.DefaultStep)
+				if adjustment != 0 {
+					c.adjust(tunable, adjustment, blockedBy, adjustments)
+					break
+				}
+			}
+		}
+
+		if len(adjustments) == 0 {
+			c.logger.Info("all tunables reached their bounds, no adjustments applied")
+		}
+	} else {
+		for _, tunable := range c.tunables {
+			suggestion := suggestions[tunable.Name]
+			if _, set := confident[tunable.Name]; set && suggestion.Recovery && suggestion.Value != 0 {
+				c.adjust(tunable, suggestion.Value, suggestion.BlockedBy, adjustments)
+			}
+		}
+	}
+
+	c.correlator.RegisterAdjustments(report, adjustments)
+}
+
+// restoreWithdrawn restores the preferred values of the tunables degraded for
+// the withdrawn metrics right away, as no further reports follow for those to
+// recover gradually. Tunables are restored once no other metric is alerting
+// only, and if correlations have been learned, only the ones correlating with
+// the withdrawn metrics.
+func (c *Controller) restoreWithdrawn(report v1alpha1.MetricReport) {
+	if len(c.alerting) > 0 {
+		c.logger.Info("metrics withdrawn while others are still alerting, tunables left as they are")
+		return
+	}
+
+	withdrawn := make(map[Metric]bool)
+	for _, notification := range report {
+		withdrawn[notification.Name] = true
+	}
+
+	adjustments := make(Adjustments)
+	for _, tunable := range c.tunables {
+		if tunable.Preferred == nil || *tunable.Preferred == tunable.Get() {
+			continue
+		}
+		if metrics := c.correlator.correlatedMetrics(tunable.Name); len(metrics) > 0 && !anyMetric(metrics, withdrawn) {
+			continue
+		}
+		c.adjust(tunable, *tunable.Preferred-tunable.Get(), NoBound, adjustments)
+	}
+
+	// Withdrawn values are not followed by the ones the adjustments
+	// result in, so register the adjustments alone
+	c.correlator.RegisterAdjustments(nil, adjustments)
+}
+
+// applySafe falls back to the safe values of the tunables while monitoring is
+// blind, reporting whether any tunable has been adjusted. Reports are handled
+// as usual otherwise, recovery is not suggested for blind metrics anyway.
+func (c *Controller) applySafe(report v1alpha1.MetricReport) bool {
+	adjustments := make(Adjustments)
+	for _, tunable := range c.tunables {
+		if tunable.Safe == nil || *tunable.Safe == tunable.Get() {
+			continue
+		}
+		current := tunable.Get()
+		if tunable.Preferred != nil && (current-*tunable.Safe)*(*tunable.Preferred-*tunable.Safe) < 0 {
+			// Degraded past the safe value already
+			continue
+		}
+		c.adjust(tunable, *tunable.Safe-current, NoBound, adjustments)
+	}
+	if len(adjustments) == 0 {
+		return false
+	}
+
+	c.logger.Info("metrics reported without current data, tunables set to their safe values")
+	c.correlator.RegisterAdjustments(report, adjustments)
+	return true
+}
+
+func anyMetric(metrics []Metric, set map[Metric]bool) bool {
+	for _, metric := range metrics {
+		if set[metric] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) adjust(tunable Tunable, adjustment float64, blockedBy Bound, adjustments Adjustments) {
+	was := tunable.Get()
+	tunable.Set(was + adjustment)
+	adjustments[tunable.Name] = adjustment
+	c.cfg.Metrics.observeAdjustment(tunable.Name, adjustment)
+
+	c.logger.V(c.cfg.LogLevels.Adjustments).Info("adjusted tunable",
+		"tunable", tunable.Name,
+		"was", was,
+		"adjustment", adjustment,
+		"now", tunable.Get(),
+		"blockedBy", blockedBy,
+	)
+}
+
+// Handler returns a webhook handler to be mounted on the application's own
+// router instead of serving metric reports on a separate port with Serve
+func (c *Controller) Handler(cfgs ...*WebhookHandlerConfig) *WebhookHandler {
+	cfg := DefaultWebhookHandlerConfig()
+	cfg.LogLevels = c.cfg.LogLevels
+	cfg.Metrics = c.cfg.Metrics
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	}
+	if cfg.Logger == nil {
+		cfgCopy := *cfg
+		cfgCopy.Logger = c.logger.WithName("webhook")
+		cfg = &cfgCopy
+	}
+	return NewWebhookHandler(c.Handle, cfg)
+}
+
+// Watch adjusts tunables in response to the status of the MetricWebhook with
+// the given name and namespace until ctx is done, instead of serving metric
+// reports pushed by the operator, see StatusWatcher
+func (c *Controller) Watch(ctx context.Context, restConfig *rest.Config, namespace, name string) error {
+	watcher, err := NewStatusWatcher(restConfig, namespace, name, c.Handle, &StatusWatcherConfig{
+		ResyncPeriod: DefaultStatusWatcherConfig().ResyncPeriod,
+		Logger:       c.logger.WithName("watcher"),
+		LogLevels:    c.cfg.LogLevels,
+		Metrics:      c.cfg.Metrics,
+	})
+	if err != nil {
+		return err
+	}
+	return watcher.Run(ctx)
+}
+
+// Serve serves metric reports until ctx is done, see WebhookServer.Serve
+func (c *Controller) Serve(ctx context.Context) error {
+	return c.server.Serve(ctx)
+}
+
+// ListenAndServe serves metric reports in background, logging failures.
+//
+// Deprecated: use Serve, that reports failures to start listening.
+func (c *Controller) ListenAndServe() {
+	c.server.ListenAndServe()
+}
+
+func (c *Controller) Shutdown(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
@@ -0,0 +1,312 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestController_Register(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality := int64(10)
+	tunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	tunable.Min = 0
+	tunable.Max = 10
+
+	assert.NoError(t, controller.Register(tunable))
+	assert.Error(t, controller.Register(tunable), "duplicate tunable")
+	assert.Error(t, controller.Register(Tunable{Name: "nogetter"}))
+
+	outOfBounds := FloatTunable("pages", func() float64 { return 100 }, func(float64) {})
+	outOfBounds.Max = 10
+	assert.Error(t, controller.Register(outOfBounds))
+
+	unsafe := FloatTunable("pages", func() float64 { return 5 }, func(float64) {})
+	unsafe.Max = 10
+	safe := float64(20)
+	unsafe.Safe = &safe
+	assert.Error(t, controller.Register(unsafe))
+}
+
+func TestController_Handle_DefaultSteps(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality, pages := int64(10), int64(10)
+
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.Min = 5
+	qualityTunable.Max = 10
+	qualityTunable.DefaultStep = -3
+	qualityTunable.Priority = 1
+	assert.NoError(t, controller.Register(qualityTunable))
+
+	pagesTunable := IntTunable("pages", func() int64 { return pages }, func(v int64) { pages = v })
+	pagesTunable.Min = 0
+	pagesTunable.Max = 10
+	pagesTunable.DefaultStep = -4
+	assert.NoError(t, controller.Register(pagesTunable))
+
+	alert := v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	}
+
+	// Higher priority tunable gets stepped first, until it reaches its bound
+	controller.Handle(context.TODO(), alert)
+	assert.Equal(t, int64(7), quality)
+	assert.Equal(t, int64(10), pages)
+
+	controller.Handle(context.TODO(), alert)
+	assert.Equal(t, int64(5), quality)
+	assert.Equal(t, int64(10), pages)
+
+	controller.Handle(context.TODO(), alert)
+	assert.Equal(t, int64(5), quality)
+	assert.Equal(t, int64(6), pages)
+}
+
+func TestController_Handle_Suggestions(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	cfg.MinSamples = 1
+	cfg.MaxRelativeError = 1000
+	cfg.AdjustmentsBufferFlushCap = -1 // manual Recorrelation()
+	controller, err := NewController(cfg)
+	assert.NoError(t, err)
+
+	quality := float64(20)
+	preferredQuality := float64(20)
+	qualityTunable := FloatTunable("quality", func() float64 { return quality }, func(v float64) { quality = v })
+	qualityTunable.Min = 0
+	qualityTunable.Max = 20
+	qualityTunable.DefaultStep = -5
+	qualityTunable.Preferred = &preferredQuality
+	assert.NoError(t, controller.Register(qualityTunable))
+
+	// Default step of -5 improves cpu by 50 and again by 40
+	for _, utilization := range []int32{100, 50} {
+		controller.Handle(context.TODO(), v1alpha1.MetricReport{
+			v1alpha1.MetricNotification{
+				Type:                      v1alpha1.Alert,
+				Name:                      "cpu",
+				CurrentAverageUtilization: func(i int32) *int32 { return &i }(utilization),
+				TargetAverageUtilization:  func(i int32) *int32 { return &i }(10),
+			},
+		})
+	}
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(10),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	})
+	controller.Correlator().Recorrelate()
+	assert.Equal(t, float64(10), quality)
+
+	// cpu may grow by 50 * 0.9 - 0 = 45, that is +5 quality given ~9 cpu per quality
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{
+		v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Cooldown,
+			Name:                      "cpu",
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(0),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		},
+	})
+	assert.InDelta(t, float64(15), quality, 0.1)
+}
+
+func TestController_Handle_Withdrawn(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality, pages := int64(10), int64(10)
+	preferredQuality := float64(10)
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.Min = 0
+	qualityTunable.Max = 10
+	qualityTunable.DefaultStep = -3
+	qualityTunable.Preferred = &preferredQuality
+	qualityTunable.Priority = 1
+	assert.NoError(t, controller.Register(qualityTunable))
+
+	pagesTunable := IntTunable("pages", func() int64 { return pages }, func(v int64) { pages = v })
+	pagesTunable.Min = 0
+	pagesTunable.Max = 10
+	pagesTunable.DefaultStep = -4
+	assert.NoError(t, controller.Register(pagesTunable))
+
+	notification := v1alpha1.MetricNotification{
+		Type:                      v1alpha1.Alert,
+		Name:                      "cpu",
+		CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+		TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+	}
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{notification})
+	assert.Equal(t, int64(7), quality)
+
+	// Tunables with a preferred value are restored at once, others are left as is
+	pages = 6
+	notification.Type = v1alpha1.Withdrawn
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{notification})
+	assert.Equal(t, int64(10), quality)
+	assert.Equal(t, int64(6), pages)
+}
+
+func TestController_Handle_WithdrawnWhileAlerting(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality := int64(10)
+	preferredQuality := float64(10)
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.Min = 0
+	qualityTunable.Max = 10
+	qualityTunable.DefaultStep = -3
+	qualityTunable.Preferred = &preferredQuality
+	assert.NoError(t, controller.Register(qualityTunable))
+
+	alert := func(name string) v1alpha1.MetricNotification {
+		return v1alpha1.MetricNotification{
+			Type:                      v1alpha1.Alert,
+			Name:                      name,
+			CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+			TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+		}
+	}
+	withdrawn := func(name string) v1alpha1.MetricNotification {
+		notification := alert(name)
+		notification.Type = v1alpha1.Withdrawn
+		return notification
+	}
+
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{alert("cpu"), alert("memory")})
+	assert.Equal(t, int64(7), quality)
+
+	// One of two alerting metrics removed from the spec, memory still needs quality degraded
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{withdrawn("cpu")})
+	assert.Equal(t, int64(7), quality)
+
+	// Restored once the last alerting metric is withdrawn, tracked by the correlator
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{withdrawn("memory")})
+	assert.Equal(t, int64(10), quality)
+	assert.Equal(t, float64(10), controller.Correlator().configConstraints["quality"].Current)
+}
+
+func TestController_Handle_WithdrawnCorrelated(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality, pages := int64(5), int64(5)
+	preferred := float64(10)
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.Min = 0
+	qualityTunable.Max = 10
+	qualityTunable.Preferred = &preferred
+	assert.NoError(t, controller.Register(qualityTunable))
+	pagesTunable := IntTunable("pages", func() int64 { return pages }, func(v int64) { pages = v })
+	pagesTunable.Min = 0
+	pagesTunable.Max = 10
+	pagesTunable.Preferred = &preferred
+	assert.NoError(t, controller.Register(pagesTunable))
+
+	correlator := controller.Correlator()
+	correlator.averageCorrelations["quality"] = map[Metric]AverageMeasurement{
+		"memory": NewAverageMeasurement(Measurement{Utilization: -2}),
+	}
+	correlator.averageCorrelations["pages"] = map[Metric]AverageMeasurement{
+		"cpu": NewAverageMeasurement(Measurement{Utilization: -2}),
+	}
+
+	// Only the tunables correlating with the withdrawn metric are restored
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{{
+		Type:                      v1alpha1.Withdrawn,
+		Name:                      "cpu",
+		CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+		TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+	}})
+	assert.Equal(t, int64(5), quality)
+	assert.Equal(t, int64(10), pages)
+}
+
+func TestController_Handle_Blind(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality, pages := int64(10), int64(10)
+	preferred, safe := float64(10), float64(6)
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.Min = 0
+	qualityTunable.Max = 10
+	qualityTunable.DefaultStep = -3
+	qualityTunable.Preferred = &preferred
+	qualityTunable.Safe = &safe
+	qualityTunable.Priority = 1
+	assert.NoError(t, controller.Register(qualityTunable))
+	pagesTunable := IntTunable("pages", func() int64 { return pages }, func(v int64) { pages = v })
+	pagesTunable.Min = 0
+	pagesTunable.Max = 10
+	pagesTunable.DefaultStep = -2
+	pagesTunable.Preferred = &preferred
+	assert.NoError(t, controller.Register(pagesTunable))
+
+	noData := v1alpha1.MetricNotification{
+		Type:                      v1alpha1.NoData,
+		Name:                      "cpu",
+		CurrentAverageUtilization: func(i int32) *int32 { return &i }(10),
+		TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+	}
+	alert := v1alpha1.MetricNotification{
+		Type:                      v1alpha1.Alert,
+		Name:                      "memory",
+		CurrentAverageUtilization: func(i int32) *int32 { return &i }(100),
+		TargetAverageUtilization:  func(i int32) *int32 { return &i }(50),
+	}
+
+	// Falls back to the safe value, tunables without one are left as they are
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{noData})
+	assert.Equal(t, int64(6), quality)
+	assert.Equal(t, int64(10), pages)
+	assert.Equal(t, float64(6), controller.Correlator().configConstraints["quality"].Current)
+
+	// At the safe value already, the report is handled as usual
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{noData, alert})
+	assert.Equal(t, int64(3), quality)
+
+	// Degraded past the safe value, not restored to it while blind
+	controller.Handle(context.TODO(), v1alpha1.MetricReport{noData})
+	assert.Equal(t, int64(3), quality)
+	assert.Equal(t, int64(10), pages)
+}
+
+func TestController_Handler(t *testing.T) {
+	controller, err := NewController()
+	assert.NoError(t, err)
+
+	quality := int64(10)
+	qualityTunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	qualityTunable.DefaultStep = -1
+	assert.NoError(t, controller.Register(qualityTunable))
+
+	router := http.NewServeMux()
+	router.Handle("/metrics-webhook", controller.Handler())
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("POST", "/metrics-webhook",
+		strings.NewReader(`[{"type":"Alert","name":"cpu","currentAverageUtilization":100,"targetAverageUtilization":50}]`)))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, int64(9), quality)
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// LogLevels are the verbosity levels (logr.Logger.V) the lib logs at
+type LogLevels struct {
+	// Reports is the level of metric reports received
+	Reports int
+	// Suggestions is the level of correlator suggestions and learned correlations
+	Suggestions int
+	// Adjustments is the level of adjustments applied to tunables
+	Adjustments int
+}
+
+func DefaultLogLevels() LogLevels {
+	return LogLevels{
+		Reports:     1,
+		Suggestions: 1,
+		Adjustments: 0,
+	}
+}
+
+// stdLogger is a logr.Logger writing to the standard log package, used
+// unless a logger is configured explicitly
+type stdLogger struct {
+	name      string
+	values    []interface{}
+	level     int
+	verbosity int
+}
+
+// NewStdLogger creates a logr.Logger writing key-value pairs to the standard
+// log package. Messages logged at levels above verbosity are dropped.
+func NewStdLogger(verbosity int) logr.Logger {
+	return &stdLogger{verbosity: verbosity}
+}
+
+func (l *stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	if !l.Enabled() {
+		return
+	}
+	l.output(msg, keysAndValues)
+}
+
+func (l *stdLogger) Enabled() bool {
+	return l.level <= l.verbosity
+}
+
+func (l *stdLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.output("ERR: "+msg, append(keysAndValues, "error", err))
+}
+
+func (l *stdLogger) V(level int) logr.InfoLogger {
+	return &stdLogger{name: l.name, values: l.values, level: l.level + level, verbosity: l.verbosity}
+}
+
+func (l *stdLogger) WithName(name string) logr.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return &stdLogger{name: name, values: l.values, level: l.level, verbosity: l.verbosity}
+}
+
+func (l *stdLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	values := append(append([]interface{}{}, l.values...), keysAndValues...)
+	return &stdLogger{name: l.name, values: values, level: l.level, verbosity: l.verbosity}
+}
+
+func (l *stdLogger) output(msg string, keysAndValues []interface{}) {
+	var tokens []string
+	if l.name != "" {
+		tokens = append(tokens, "["+l.name+"]")
+	}
+	tokens = append(tokens, msg)
+
+	values := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i < len(values); i += 2 {
+		if i+1 < len(values) {
+			tokens = append(tokens, fmt.Sprintf("%v=%v", values[i], values[i+1]))
+		} else {
+			tokens = append(tokens, fmt.Sprintf("%v", values[i]))
+		}
+	}
+	log.Print(strings.Join(tokens, " "))
+}
+
+// discardLogger is a logr.Logger dropping all messages
+type discardLogger struct{}
+
+// NewDiscardLogger creates a logr.Logger that drops all messages
+func NewDiscardLogger() logr.Logger {
+	return discardLogger{}
+}
+
+func (discardLogger) Info(string, ...interface{})             {}
+func (discardLogger) Enabled() bool                           { return false }
+func (discardLogger) Error(error, string, ...interface{})     {}
+func (l discardLogger) V(int) logr.InfoLogger                 { return l }
+func (l discardLogger) WithName(string) logr.Logger           { return l }
+func (l discardLogger) WithValues(...interface{}) logr.Logger { return l }
+
+// reportValues are the structured fields describing a metric report
+func reportValues(report v1alpha1.MetricReport) []interface{} {
+	var alerts, cooldowns, noData, stale, withdrawn []string
+	for _, notification := range report {
+		switch notification.Type {
+		case v1alpha1.Alert:
+			alerts = append(alerts, notification.Name)
+		case v1alpha1.Cooldown:
+			cooldowns = append(cooldowns, notification.Name)
+		case v1alpha1.NoData:
+			noData = append(noData, notification.Name)
+		case v1alpha1.Stale:
+			stale = append(stale, notification.Name)
+		case v1alpha1.Withdrawn:
+			withdrawn = append(withdrawn, notification.Name)
+		}
+	}
+	return []interface{}{
+		"notifications", len(report),
+		"alerts", alerts,
+		"cooldowns", cooldowns,
+		"noData", noData,
+		"stale", stale,
+		"withdrawn", withdrawn,
+		"report", report.String(),
+	}
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestStdLogger(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	logger := NewStdLogger(1).WithName("webhook").WithValues("port", 4030)
+
+	logger.Info("listening", "addr", ":4030")
+	assert.Equal(t, "[webhook] listening port=4030 addr=:4030\n", output.String())
+
+	output.Reset()
+	logger.V(1).Info("received metric report", reportValues(v1alpha1.MetricReport{
+		{Type: v1alpha1.Alert, Name: "cpu"},
+		{Type: v1alpha1.Cooldown, Name: "ram"},
+	})...)
+	assert.Contains(t, output.String(), "notifications=2 alerts=[cpu] cooldowns=[ram]")
+
+	output.Reset()
+	logger.V(2).Info("too verbose")
+	assert.Empty(t, output.String())
+	assert.False(t, logger.V(2).Enabled())
+
+	output.Reset()
+	logger.WithName("handler").Error(errors.New("boom"), "failed")
+	assert.Equal(t, "[webhook.handler] ERR: failed port=4030 error=boom\n", output.String())
+
+	output.Reset()
+	NewDiscardLogger().Error(errors.New("boom"), "failed")
+	assert.Empty(t, output.String())
+}
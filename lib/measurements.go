@@ -1,8 +1,10 @@
 package lib
 
 import (
-	"k8s.io/apimachinery/pkg/api/resource"
+	"math"
 	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 type Measurement struct {
@@ -29,6 +31,20 @@ func (i Measurement) Sub(m Measurement) Measurement {
 	}
 }
 
+func (i Measurement) Add(m Measurement) Measurement {
+	return Measurement{
+		Value:       i.Value + m.Value,
+		Utilization: i.Utilization + m.Utilization,
+	}
+}
+
+func (i Measurement) Mul(m Measurement) Measurement {
+	return Measurement{
+		Value:       i.Value * m.Value,
+		Utilization: i.Utilization * m.Utilization,
+	}
+}
+
 func (i Measurement) GoesInto(m Measurement) float64 {
 	utilTimes := float64(0)
 	if i.Utilization != 0 && m.Utilization != 0 {
@@ -56,9 +72,15 @@ func (i Measurement) Scale(f float64) Measurement {
 	}
 }
 
+// AverageMeasurement is a running mean of measurements that also keeps track
+// of the spread of the values averaged, so that the mean can be
+// given a confidence interval.
 type AverageMeasurement struct {
 	Value Measurement
 	Among int
+	// Variance is the unbiased sample variance of the measurements averaged.
+	// It is zero unless the average is built among at least two measurements.
+	Variance Measurement
 }
 
 func NewAverageMeasurement(improvements ...Measurement) AverageMeasurement {
@@ -77,20 +99,68 @@ func NewAverageMeasurement(improvements ...Measurement) AverageMeasurement {
 		averageValueSum = averageValueSum + improvement.Value
 	}
 
+	mean := Measurement{
+		Value:       averageValueSum / float64(len(improvements)),
+		Utilization: averageUtilizationSum / float64(len(improvements)),
+	}
+
+	var variance Measurement
+	if len(improvements) > 1 {
+		var squaredDeviationsSum Measurement
+		for _, improvement := range improvements {
+			deviation := improvement.Sub(mean)
+			squaredDeviationsSum = squaredDeviationsSum.Add(deviation.Mul(deviation))
+		}
+		variance = squaredDeviationsSum.Scale(1.0 / float64(len(improvements)-1))
+	}
+
 	return AverageMeasurement{
-		Value: Measurement{
-			Value:       averageValueSum / float64(len(improvements)),
-			Utilization: averageUtilizationSum / float64(len(improvements)),
-		},
-		Among: len(improvements),
+		Value:    mean,
+		Among:    len(improvements),
+		Variance: variance,
 	}
 }
 
+// Concat merges improvements into the average, combining both means and
+// variances without the need of the original measurements.
 func (a AverageMeasurement) Concat(improvements ...Measurement) AverageMeasurement {
-	for i := 0; i < a.Among; i++ {
-		improvements = append(improvements, a.Value)
+	b := NewAverageMeasurement(improvements...)
+	if a.Among == 0 {
+		return b
+	} else if b.Among == 0 {
+		return a
+	}
+
+	among := a.Among + b.Among
+	delta := b.Value.Sub(a.Value)
+	mean := a.Value.Add(delta.Scale(float64(b.Among) / float64(among)))
+
+	// Chan et al. parallel algorithm for combining sums of squared deviations
+	squaredDeviationsSum := a.Variance.Scale(float64(a.Among - 1)).
+		Add(b.Variance.Scale(float64(b.Among - 1))).
+		Add(delta.Mul(delta).Scale(float64(a.Among) * float64(b.Among) / float64(among)))
+
+	return AverageMeasurement{
+		Value:    mean,
+		Among:    among,
+		Variance: squaredDeviationsSum.Scale(1.0 / float64(among-1)),
+	}
+}
+
+// StandardError returns the standard error of the mean, or +Inf for
+// the components that cannot be estimated from less than two measurements.
+func (a AverageMeasurement) StandardError() Measurement {
+	if a.Among < 2 {
+		return Measurement{
+			Value:       math.Inf(1),
+			Utilization: math.Inf(1),
+		}
+	}
+
+	return Measurement{
+		Value:       math.Sqrt(a.Variance.Value / float64(a.Among)),
+		Utilization: math.Sqrt(a.Variance.Utilization / float64(a.Among)),
 	}
-	return NewAverageMeasurement(improvements...)
 }
 
 func quantityAsFloat64(quantity resource.Quantity) float64 {
@@ -98,3 +168,21 @@ func quantityAsFloat64(quantity resource.Quantity) float64 {
 	quantityAsFloat64, _ := strconv.ParseFloat((&quantityCopy).AsDec().String(), 64)
 	return quantityAsFloat64
 }
+
+// studentT95 is the two-sided 95% critical value of Student's t-distribution
+// for the given degrees of freedom, approximated by the normal one past 30.
+func studentT95(degreesOfFreedom int) float64 {
+	table := [...]float64{
+		12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+	}
+	switch {
+	case degreesOfFreedom < 1:
+		return math.Inf(1)
+	case degreesOfFreedom <= len(table):
+		return table[degreesOfFreedom-1]
+	default:
+		return 1.960
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -91,6 +92,26 @@ func TestAverageMeasurement_Concat(t *testing.T) {
 	assert.Equal(t, 3, firstAndMedianAndLastMeasurement.Among)
 	assert.Equal(t, quantityAsFloat64(expectedAvgAverageValue), firstAndMedianAndLastMeasurement.Value.Value)
 	assert.InDelta(t, float64(expectedAvgAverageUtilization), firstAndMedianAndLastMeasurement.Value.Utilization, 0.01)
+
+	// Concatenated variance equals the one calculated among all measurements at once
+	allAtOnceMeasurement := NewAverageMeasurement(improvementFirst, improvementMedian, improvementLast)
+	assert.InDelta(t, allAtOnceMeasurement.Variance.Utilization, firstAndMedianAndLastMeasurement.Variance.Utilization, 0.01)
+	assert.InDelta(t, allAtOnceMeasurement.Variance.Value/allAtOnceMeasurement.Variance.Value,
+		firstAndMedianAndLastMeasurement.Variance.Value/allAtOnceMeasurement.Variance.Value, 0.01)
+}
+
+func TestNewAverageMeasurement_Variance(t *testing.T) {
+	averageMeasurement := NewAverageMeasurement(
+		Measurement{Utilization: 10},
+		Measurement{Utilization: 20},
+		Measurement{Utilization: 30},
+	)
+	assert.InDelta(t, 100.0, averageMeasurement.Variance.Utilization, 0.01) // ((-10)^2 + 0 + 10^2) / (3 - 1)
+	assert.InDelta(t, 10.0/math.Sqrt(3), averageMeasurement.StandardError().Utilization, 0.01)
+
+	singleMeasurement := NewAverageMeasurement(Measurement{Utilization: 10})
+	assert.Equal(t, 0.0, singleMeasurement.Variance.Utilization)
+	assert.True(t, math.IsInf(singleMeasurement.StandardError().Utilization, 1))
 }
 
 func TestMeasurement_GoesInto(t *testing.T) {
@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Metrics are Prometheus collectors describing the adaptive loop of an
+// application: reports received, suggestions issued, adjustments applied and
+// correlations learned. Register them on the application's registry and pass
+// to WebhookHandlerConfig, AdjustmentCorrelator.SetMetrics or ControllerConfig.
+// All methods are no-ops on a nil *Metrics.
+type Metrics struct {
+	reportsReceived  *prometheus.CounterVec
+	decodeFailures   prometheus.Counter
+	callbackDuration *prometheus.HistogramVec
+	suggestions      *prometheus.CounterVec
+	adjustments      *prometheus.HistogramVec
+	correlations     *prometheus.GaugeVec
+}
+
+// NewMetrics creates the collectors with names prefixed by namespace,
+// e.g. <namespace>_reports_received_total
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		reportsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reports_received_total",
+			Help:      "Metric notifications received, by notification type and metric.",
+		}, []string{"type", "metric"}),
+		decodeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "report_decode_failures_total",
+			Help:      "Webhook requests which body failed to decode as a metric report.",
+		}),
+		callbackDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "callback_duration_seconds",
+			Help:      "Time spent processing metric reports, by outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome"}),
+		suggestions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "suggestions_total",
+			Help:      "Adjustments suggested by the correlator, by config and whether restoring it.",
+		}, []string{"config", "recovery"}),
+		adjustments: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "adjustment_magnitude",
+			Help:      "Absolute value of adjustments applied, by config.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 10, 8),
+		}, []string{"config"}),
+		correlations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "correlation_coefficient",
+			Help:      "Learned metric improvement per unit of config change, by config, metric and component (value or utilization).",
+		}, []string{"config", "metric", "component"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.reportsReceived, m.decodeFailures, m.callbackDuration,
+		m.suggestions, m.adjustments, m.correlations,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range m.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range m.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (m *Metrics) observeReport(report v1alpha1.MetricReport) {
+	if m == nil {
+		return
+	}
+	for _, notification := range report {
+		m.reportsReceived.WithLabelValues(string(notification.Type), notification.Name).Inc()
+	}
+}
+
+func (m *Metrics) observeDecodeFailure() {
+	if m == nil {
+		return
+	}
+	m.decodeFailures.Inc()
+}
+
+func (m *Metrics) observeCallback(outcome string, since time.Time) {
+	if m == nil {
+		return
+	}
+	m.callbackDuration.WithLabelValues(outcome).Observe(time.Since(since).Seconds())
+}
+
+func (m *Metrics) observeSuggestion(config Config, suggestion Suggestion) {
+	if m == nil {
+		return
+	}
+	m.suggestions.WithLabelValues(config, strconv.FormatBool(suggestion.Recovery)).Inc()
+}
+
+func (m *Metrics) observeAdjustment(config Config, adjustment float64) {
+	if m == nil {
+		return
+	}
+	m.adjustments.WithLabelValues(config).Observe(math.Abs(adjustment))
+}
+
+func (m *Metrics) observeCorrelation(config Config, metric Metric, correlation AverageMeasurement) {
+	if m == nil {
+		return
+	}
+	m.correlations.WithLabelValues(config, metric, "value").Set(correlation.Value.Value)
+	m.correlations.WithLabelValues(config, metric, "utilization").Set(correlation.Value.Utilization)
+}
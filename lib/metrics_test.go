@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestMetrics_Register(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(NewMetrics("app")))
+	assert.Error(t, registry.Register(NewMetrics("app")), "duplicate collectors")
+	assert.NoError(t, registry.Register(NewMetrics("other")))
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var metrics *Metrics
+	assert.NotPanics(t, func() {
+		metrics.observeReport(v1alpha1.MetricReport{{Type: v1alpha1.Alert, Name: "cpu"}})
+		metrics.observeDecodeFailure()
+		metrics.observeSuggestion("quality", Suggestion{})
+		metrics.observeAdjustment("quality", -1)
+	})
+}
+
+func TestMetrics_WebhookHandler(t *testing.T) {
+	metrics := NewMetrics("app")
+	cfg := DefaultWebhookHandlerConfig()
+	cfg.Metrics = metrics
+	cfg.Logger = NewDiscardLogger()
+	handler := NewWebhookHandler(func(context.Context, v1alpha1.MetricReport) {}, cfg)
+
+	report := `[{"type":"Alert","name":"cpu"},{"type":"Cooldown","name":"memory"}]`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(report)))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("{")))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reportsReceived.WithLabelValues("Alert", "cpu")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reportsReceived.WithLabelValues("Cooldown", "memory")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.decodeFailures))
+	assert.Equal(t, uint64(1), histogramSampleCount(t, metrics, "app_callback_duration_seconds"))
+}
+
+func TestMetrics_Controller(t *testing.T) {
+	metrics := NewMetrics("app")
+	cfg := DefaultControllerConfig()
+	cfg.Metrics = metrics
+	cfg.Logger = NewDiscardLogger()
+	controller, err := NewController(cfg)
+	assert.NoError(t, err)
+
+	quality := int64(10)
+	tunable := IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	tunable.Min = 0
+	tunable.Max = 10
+	tunable.DefaultStep = -2
+	assert.NoError(t, controller.Register(tunable))
+
+	alert := `[{"type":"Alert","name":"cpu","currentAverageUtilization":100,"targetAverageUtilization":50}]`
+	res := httptest.NewRecorder()
+	controller.Handler().ServeHTTP(res, httptest.NewRequest("POST", "/", strings.NewReader(alert)))
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reportsReceived.WithLabelValues("Alert", "cpu")))
+	assert.Equal(t, uint64(1), histogramSampleCount(t, metrics, "app_adjustment_magnitude"))
+	assert.Equal(t, int64(8), quality)
+}
+
+func TestMetrics_AdjustmentCorrelator(t *testing.T) {
+	metrics := NewMetrics("app")
+	correlator, err := NewAdjustmentCorrelator(-1, 0)
+	assert.NoError(t, err)
+	correlator.SetLogger(NewDiscardLogger(), DefaultLogLevels())
+	correlator.SetMetrics(metrics)
+
+	utilization := func(i int32) *int32 { return &i }
+	correlator.RegisterAdjustments(v1alpha1.MetricReport{{
+		Type: v1alpha1.Alert, Name: "cpu",
+		CurrentAverageUtilization: utilization(100), TargetAverageUtilization: utilization(50),
+	}}, Adjustments{"quality": -1})
+	correlator.RegisterAdjustments(v1alpha1.MetricReport{{
+		Type: v1alpha1.Alert, Name: "cpu",
+		CurrentAverageUtilization: utilization(90), TargetAverageUtilization: utilization(50),
+	}}, Adjustments{"quality": -1})
+	correlator.Recorrelate()
+
+	assert.Equal(t, -10.0, testutil.ToFloat64(metrics.correlations.WithLabelValues("quality", "cpu", "utilization")))
+
+	correlator.SuggestAdjustments(v1alpha1.MetricReport{{
+		Type: v1alpha1.Alert, Name: "cpu",
+		CurrentAverageUtilization: utilization(80), TargetAverageUtilization: utilization(50),
+	}})
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.suggestions.WithLabelValues("quality", "false")))
+}
+
+func histogramSampleCount(t *testing.T, metrics *Metrics, name string) uint64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	var count uint64
+	for _, family := range families {
+		if family.GetName() == name {
+			for _, metric := range family.GetMetric() {
+				count += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,254 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+type ReportSubscriberConfig struct {
+	// Token authenticates the subscriber, a Kubernetes token allowed to get
+	// the MetricWebhooks subscribed to. If empty, TokenFile is read on every
+	// connection so that rotated tokens are picked up.
+	Token     string
+	TokenFile string
+	// HTTPClient connects to the operator, it must not time out streams
+	HTTPClient *http.Client
+	// MinReconnectBackoff and MaxReconnectBackoff bound the exponential backoff
+	// between reconnection attempts
+	MinReconnectBackoff time.Duration
+	MaxReconnectBackoff time.Duration
+	// Logger logs connection failures and reports received,
+	// defaults to the standard log package
+	Logger logr.Logger
+	// LogLevels sets the verbosity of reports received
+	LogLevels LogLevels
+	// Metrics records reports received and callback latencies,
+	// nil disables instrumentation
+	Metrics *Metrics
+}
+
+func DefaultReportSubscriberConfig() *ReportSubscriberConfig {
+	return &ReportSubscriberConfig{
+		TokenFile:           serviceAccountTokenFile,
+		HTTPClient:          &http.Client{},
+		MinReconnectBackoff: time.Second,
+		MaxReconnectBackoff: time.Minute,
+		LogLevels:           DefaultLogLevels(),
+	}
+}
+
+// ReportSubscriber receives metric reports streamed by the operator as
+// Server-Sent Events, for applications outside the cluster or behind NAT
+// the operator cannot POST reports to. It reconnects on failures, resuming
+// from the last report received.
+type ReportSubscriber struct {
+	streamUrl string
+	callback  Webhook
+	cfg       *ReportSubscriberConfig
+	logger    logr.Logger
+
+	lastEventID string
+}
+
+// NewReportSubscriber creates a subscriber to the reports of the MetricWebhooks,
+// given as "<namespace>/<name>", streamed at streamUrl, e.g.
+// http://metrics-webhook.operators.svc:8484/reports. Reports of all
+// the MetricWebhooks are passed to the same callback.
+func NewReportSubscriber(streamUrl string, webhooks []string, callback Webhook, cfgs ...*ReportSubscriberConfig) (*ReportSubscriber, error) {
+	var cfg *ReportSubscriberConfig
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = DefaultReportSubscriberConfig()
+	}
+
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("at least one webhook must be subscribed to")
+	}
+	parsedUrl, err := url.Parse(streamUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream url: %v", err)
+	}
+	query := parsedUrl.Query()
+	for _, webhook := range webhooks {
+		if tokens := strings.SplitN(webhook, "/", 2); len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return nil, fmt.Errorf("invalid webhook %q, <namespace>/<name> expected", webhook)
+		}
+		query.Add("webhook", webhook)
+	}
+	parsedUrl.RawQuery = query.Encode()
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewStdLogger(0).WithName("subscriber")
+	}
+
+	return &ReportSubscriber{
+		streamUrl: parsedUrl.String(),
+		callback:  callback,
+		cfg:       cfg,
+		logger:    logger,
+	}, nil
+}
+
+// Run receives reports until ctx is done, passing ctx to callbacks. Callbacks
+// are never invoked concurrently. It fails if the operator rejects the token.
+func (s *ReportSubscriber) Run(ctx context.Context) error {
+	backoff := s.cfg.MinReconnectBackoff
+	for {
+		received, err := s.stream(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if IsPermanent(err) {
+			return err
+		}
+		if received {
+			backoff = s.cfg.MinReconnectBackoff
+		}
+		s.logger.Error(err, "report stream disconnected, reconnecting", "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.cfg.MaxReconnectBackoff {
+			backoff = s.cfg.MaxReconnectBackoff
+		}
+	}
+}
+
+// stream consumes a single connection, telling whether it received any events
+func (s *ReportSubscriber) stream(ctx context.Context) (bool, error) {
+	token, err := s.token()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("GET", s.streamUrl, nil)
+	if err != nil {
+		return false, Permanent(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+
+	res, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		err := fmt.Errorf("report stream rejected: status = %d, body = %s", res.StatusCode, strings.TrimSpace(string(body)))
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusBadRequest {
+			return false, Permanent(err)
+		}
+		return false, err
+	}
+
+	received := false
+	err = readEvents(res.Body, func(id, typ, data string) {
+		received = true
+		s.handleEvent(ctx, id, typ, data)
+	})
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return received, err
+}
+
+func (s *ReportSubscriber) handleEvent(ctx context.Context, id, typ, data string) {
+	switch typ {
+	case "gap":
+		s.logger.Info("some metric reports have been missed while disconnected")
+	case "report":
+		var event v1alpha1.MetricReportEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			s.logger.Error(err, "failed to decode metric report event", "id", id)
+			return
+		}
+		s.logger.V(s.cfg.LogLevels.Reports).Info("received metric report",
+			append([]interface{}{"webhook", event.Namespace + "/" + event.Name}, reportValues(event.Report)...)...)
+		s.cfg.Metrics.observeReport(event.Report)
+
+		start := time.Now()
+		s.callback(ctx, event.Report)
+		s.cfg.Metrics.observeCallback("processed", start)
+	}
+	if id != "" {
+		s.lastEventID = id
+	}
+}
+
+func (s *ReportSubscriber) token() (string, error) {
+	if s.cfg.Token != "" || s.cfg.TokenFile == "" {
+		return s.cfg.Token, nil
+	}
+	token, err := ioutil.ReadFile(s.cfg.TokenFile)
+	if err != nil {
+		return "", Permanent(fmt.Errorf("failed to read token: %v", err))
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// readEvents parses a Server-Sent Events stream until it ends
+func readEvents(r io.Reader, handle func(id, typ, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var id, typ string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if typ == "" {
+					typ = "message"
+				}
+				handle(id, typ, strings.Join(data, "\n"))
+			}
+			id, typ, data = "", "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, e.g. heartbeat
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			typ = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": heartbeat\n\n" +
+		"id: 1-1\nevent: report\ndata: {\"a\":\ndata: 1}\n\n" +
+		"event: gap\ndata: {}\n\n" +
+		"data: plain\n\n"
+
+	var events []string
+	err := readEvents(strings.NewReader(stream), func(id, typ, data string) {
+		events = append(events, fmt.Sprintf("%s|%s|%s", id, typ, data))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1-1|report|{\"a\":\n1}", "|gap|{}", "|message|plain"}, events)
+}
+
+func TestReportSubscriber_Run(t *testing.T) {
+	var mu sync.Mutex
+	var lastEventIDs []string
+	connections := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, []string{"default/app"}, r.URL.Query()["webhook"])
+
+		mu.Lock()
+		connections++
+		connection := connections
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: 1-%d\nevent: report\ndata: {\"namespace\":\"default\",\"name\":\"app\",\"report\":[{\"type\":\"Alert\",\"name\":\"cpu%d\"}]}\n\n", connection, connection)
+		// Connection drops right after the event
+	}))
+	defer server.Close()
+
+	reports := make(chan v1alpha1.MetricReport, 10)
+	cfg := DefaultReportSubscriberConfig()
+	cfg.Token = "secret"
+	cfg.MinReconnectBackoff = time.Millisecond
+	cfg.Logger = NewDiscardLogger()
+	subscriber, err := NewReportSubscriber(server.URL+"/reports", []string{"default/app"}, func(ctx context.Context, report v1alpha1.MetricReport) {
+		reports <- report
+	}, cfg)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- subscriber.Run(ctx)
+	}()
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case report := <-reports:
+			assert.Equal(t, fmt.Sprintf("cpu%d", i), report[0].Name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no report received")
+		}
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "", lastEventIDs[0])
+	assert.Equal(t, "1-1", lastEventIDs[1], "resumes from the last event")
+}
+
+func TestReportSubscriber_Run_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthenticated", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cfg := DefaultReportSubscriberConfig()
+	cfg.Token = "wrong"
+	cfg.Logger = NewDiscardLogger()
+	subscriber, err := NewReportSubscriber(server.URL, []string{"default/app"}, func(context.Context, v1alpha1.MetricReport) {}, cfg)
+	assert.NoError(t, err)
+	assert.Error(t, subscriber.Run(context.Background()))
+}
+
+func TestNewReportSubscriber_InvalidWebhooks(t *testing.T) {
+	callback := func(context.Context, v1alpha1.MetricReport) {}
+	_, err := NewReportSubscriber("http://localhost", nil, callback)
+	assert.Error(t, err)
+	_, err = NewReportSubscriber("http://localhost", []string{"app"}, callback)
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package simulate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/wingsofovnia/metrics-webhook/lib"
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Replay sends the callback the scripted or recorded reports one by one and
+// returns their trace. Configs and Correlator of the config are traced,
+// the rest of it is ignored.
+func Replay(ctx context.Context, callback lib.Webhook, reports []v1alpha1.MetricReport, cfgs ...*Config) Trace {
+	cfg := DefaultConfig()
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	}
+	readConfigs := func() map[lib.Config]float64 {
+		configs := make(map[lib.Config]float64)
+		for config, get := range cfg.Configs {
+			configs[config] = get()
+		}
+		return configs
+	}
+
+	var trace Trace
+	for i, report := range reports {
+		if ctx.Err() != nil {
+			break
+		}
+
+		step := TraceStep{
+			Step:    i,
+			Configs: readConfigs(),
+			Report:  report,
+		}
+		if cfg.Correlator != nil {
+			step.Suggestions = cfg.Correlator.SuggestAdjustments(report)
+		}
+		callback(ctx, report)
+		step.Adjusted = readConfigs()
+
+		trace = append(trace, step)
+	}
+	return trace
+}
+
+// Record wraps the callback to write every report it receives to w as
+// a JSON line, to be replayed later on with ReadReports and Replay
+func Record(w io.Writer, callback lib.Webhook) lib.Webhook {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(ctx context.Context, report v1alpha1.MetricReport) {
+		mu.Lock()
+		_ = encoder.Encode(report)
+		mu.Unlock()
+		callback(ctx, report)
+	}
+}
+
+// ReadReports reads reports written by Record, one JSON report per line
+func ReadReports(r io.Reader) ([]v1alpha1.MetricReport, error) {
+	var reports []v1alpha1.MetricReport
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var report v1alpha1.MetricReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			return nil, fmt.Errorf("invalid report at line %d: %v", line, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, scanner.Err()
+}
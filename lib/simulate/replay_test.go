@@ -0,0 +1,53 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/lib"
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestRecord_Replay(t *testing.T) {
+	utilization := func(i int32) *int32 { return &i }
+	reports := []v1alpha1.MetricReport{
+		{{Type: v1alpha1.Alert, Name: "cpu", CurrentAverageUtilization: utilization(80), TargetAverageUtilization: utilization(50)}},
+		{{Type: v1alpha1.Cooldown, Name: "cpu", CurrentAverageUtilization: utilization(40), TargetAverageUtilization: utilization(50)}},
+	}
+
+	var recorded bytes.Buffer
+	received := 0
+	recorder := Record(&recorded, func(context.Context, v1alpha1.MetricReport) { received++ })
+	for _, report := range reports {
+		recorder(context.TODO(), report)
+	}
+	assert.Equal(t, 2, received)
+
+	replayed, err := ReadReports(&recorded)
+	assert.NoError(t, err)
+	assert.Len(t, replayed, 2)
+
+	quality := 10.0
+	cfg := DefaultConfig()
+	cfg.Configs["quality"] = func() float64 { return quality }
+	trace := Replay(context.TODO(), func(ctx context.Context, report v1alpha1.MetricReport) {
+		if report.HasAlerts() {
+			quality--
+		}
+	}, replayed, cfg)
+
+	assert.Len(t, trace, 2)
+	assert.Equal(t, 1, trace.Alerts())
+	assert.Equal(t, map[lib.Config]float64{"quality": 10}, trace[0].Configs)
+	assert.Equal(t, map[lib.Config]float64{"quality": 9}, trace[0].Adjusted)
+	assert.Equal(t, int32(40), *trace[1].Report[0].CurrentAverageUtilization)
+}
+
+func TestReadReports_Invalid(t *testing.T) {
+	_, err := ReadReports(strings.NewReader("[]\n{"))
+	assert.Error(t, err)
+}
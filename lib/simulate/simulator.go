@@ -0,0 +1,237 @@
+// Package simulate drives lib.Webhook callbacks with a synthetic workload,
+// so that correlator tuning and application adjustment logic can be tested
+// without a cluster
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/wingsofovnia/metrics-webhook/lib"
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Model maps the config values in effect to the metric values at the given step
+type Model func(step int, configs map[lib.Config]float64) map[lib.Metric]float64
+
+// LinearModel is a Model of metrics being the load at the step multiplied by
+// a base value plus the sum of configs weighted by their coefficients
+func LinearModel(base map[lib.Metric]float64, coefficients map[lib.Config]map[lib.Metric]float64, load func(step int) float64) Model {
+	return func(step int, configs map[lib.Config]float64) map[lib.Metric]float64 {
+		metrics := make(map[lib.Metric]float64)
+		for metric, value := range base {
+			for config, configValue := range configs {
+				value += coefficients[config][metric] * configValue
+			}
+			if load != nil {
+				value *= load(step)
+			}
+			metrics[metric] = value
+		}
+		return metrics
+	}
+}
+
+// ConstantLoad is a load of the same factor at every step
+func ConstantLoad(factor float64) func(int) float64 {
+	return func(int) float64 { return factor }
+}
+
+// StepLoad is a load of the given factors, switching to the next one every
+// steps steps and staying at the last one afterwards. It panics if steps is
+// not positive or no factors are given.
+func StepLoad(steps int, factors ...float64) func(int) float64 {
+	if steps <= 0 {
+		panic(fmt.Sprintf("simulate: StepLoad steps must be positive, got %d", steps))
+	}
+	if len(factors) == 0 {
+		panic("simulate: StepLoad requires at least one factor")
+	}
+	return func(step int) float64 {
+		i := step / steps
+		if i >= len(factors) {
+			i = len(factors) - 1
+		}
+		return factors[i]
+	}
+}
+
+// MetricSpec describes a simulated metric and its target
+type MetricSpec struct {
+	Name lib.Metric
+	// Target is the value the metric alerts above
+	Target float64
+	// Utilization reports the metric as a Resource utilization percentage
+	// instead of a Pods average value
+	Utilization bool
+}
+
+type Config struct {
+	// Metrics are the metrics reported, in the order of the notifications
+	Metrics []MetricSpec
+	// Configs read the current config values of the application
+	Configs map[lib.Config]func() float64
+	// Noise is the standard deviation of the metric values relative to their
+	// model values, e.g. 0.05 for 5% noise
+	Noise float64
+	// Lag is the number of steps config changes take to affect metrics
+	Lag int
+	// CooldownAlert reports metrics improving below their targets, as the
+	// MetricWebhook spec field of the same name
+	CooldownAlert bool
+	// Seed makes the noise reproducible
+	Seed int64
+	// Start and Interval set the scrape times of the reports
+	Start    time.Time
+	Interval time.Duration
+	// Correlator, if set, is asked for suggestions on each report to be traced,
+	// e.g. lib.Controller.Correlator
+	Correlator *lib.AdjustmentCorrelator
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Configs:       make(map[lib.Config]func() float64),
+		CooldownAlert: true,
+		Seed:          1,
+		Start:         time.Unix(0, 0).UTC(),
+		Interval:      30 * time.Second,
+	}
+}
+
+// Simulator scrapes a workload Model the way the operator scrapes metrics
+// and sends the callback the metric reports the operator would send
+type Simulator struct {
+	model Model
+	cfg   *Config
+	rand  *rand.Rand
+
+	// history of config values, the last Lag+1 ones
+	history  []map[lib.Config]float64
+	alerting map[lib.Metric]bool
+	step     int
+}
+
+func NewSimulator(model Model, cfgs ...*Config) (*Simulator, error) {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = DefaultConfig()
+	}
+
+	if cfg.Lag < 0 {
+		return nil, fmt.Errorf("lag must not be negative")
+	}
+	if cfg.Noise < 0 {
+		return nil, fmt.Errorf("noise must not be negative")
+	}
+	if len(cfg.Metrics) == 0 {
+		return nil, fmt.Errorf("at least one metric must be simulated")
+	}
+
+	return &Simulator{
+		model:    model,
+		cfg:      cfg,
+		rand:     rand.New(rand.NewSource(cfg.Seed)),
+		alerting: make(map[lib.Metric]bool),
+	}, nil
+}
+
+// Run simulates the given number of scrapes, invoking the callback
+// for each non-empty report, and returns their trace
+func (s *Simulator) Run(ctx context.Context, callback lib.Webhook, steps int) Trace {
+	var trace Trace
+	for i := 0; i < steps && ctx.Err() == nil; i++ {
+		trace = append(trace, s.Step(ctx, callback))
+	}
+	return trace
+}
+
+// Step simulates a single scrape
+func (s *Simulator) Step(ctx context.Context, callback lib.Webhook) TraceStep {
+	configs := s.readConfigs()
+	s.history = append(s.history, configs)
+	if len(s.history) > s.cfg.Lag+1 {
+		s.history = s.history[1:]
+	}
+	effective := s.history[0]
+
+	modelled := s.model(s.step, effective)
+	metrics := make(map[lib.Metric]float64)
+	scrapeTime := s.cfg.Start.Add(time.Duration(s.step) * s.cfg.Interval)
+
+	var alerts, cooldowns v1alpha1.MetricReport
+	for _, spec := range s.cfg.Metrics {
+		value := modelled[spec.Name] * (1 + s.cfg.Noise*s.rand.NormFloat64())
+		metrics[spec.Name] = value
+
+		alerting := value > spec.Target
+		switch {
+		case alerting:
+			alerts = append(alerts, notification(v1alpha1.Alert, spec, value, scrapeTime))
+		case s.alerting[spec.Name] && s.cfg.CooldownAlert:
+			cooldowns = append(cooldowns, notification(v1alpha1.Cooldown, spec, value, scrapeTime))
+		}
+		s.alerting[spec.Name] = alerting
+	}
+	report := append(alerts, cooldowns...)
+
+	step := TraceStep{
+		Step:    s.step,
+		Configs: configs,
+		Metrics: metrics,
+		Report:  report,
+	}
+	if len(report) > 0 {
+		if s.cfg.Correlator != nil {
+			step.Suggestions = s.cfg.Correlator.SuggestAdjustments(report)
+		}
+		callback(ctx, report)
+	}
+	step.Adjusted = s.readConfigs()
+
+	s.step++
+	return step
+}
+
+func (s *Simulator) readConfigs() map[lib.Config]float64 {
+	configs := make(map[lib.Config]float64)
+	for config, get := range s.cfg.Configs {
+		configs[config] = get()
+	}
+	return configs
+}
+
+func notification(typ v1alpha1.MetricNotificationType, spec MetricSpec, value float64, scrapeTime time.Time) v1alpha1.MetricNotification {
+	if spec.Utilization {
+		current, target := int32(math.Round(value)), int32(math.Round(spec.Target))
+		return v1alpha1.MetricNotification{
+			Type:                      typ,
+			MetricType:                v1alpha1.ResourceMetricSourceType,
+			Name:                      spec.Name,
+			CurrentAverageUtilization: &current,
+			TargetAverageUtilization:  &target,
+			ScrapeTime:                scrapeTime,
+		}
+	}
+
+	target := quantity(spec.Target)
+	return v1alpha1.MetricNotification{
+		Type:                typ,
+		MetricType:          v1alpha1.PodsMetricSourceType,
+		Name:                spec.Name,
+		CurrentAverageValue: quantity(value),
+		TargetAverageValue:  &target,
+		ScrapeTime:          scrapeTime,
+	}
+}
+
+func quantity(value float64) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+}
@@ -0,0 +1,131 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/lib"
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestLinearModel(t *testing.T) {
+	model := LinearModel(
+		map[lib.Metric]float64{"cpu": 10},
+		map[lib.Config]map[lib.Metric]float64{"quality": {"cpu": 5}},
+		StepLoad(2, 1, 2),
+	)
+
+	assert.Equal(t, 60.0, model(0, map[lib.Config]float64{"quality": 10})["cpu"])
+	assert.Equal(t, 60.0, model(1, map[lib.Config]float64{"quality": 10})["cpu"])
+	assert.Equal(t, 120.0, model(2, map[lib.Config]float64{"quality": 10})["cpu"])
+	assert.Equal(t, 120.0, model(10, map[lib.Config]float64{"quality": 10})["cpu"])
+}
+
+func TestStepLoad(t *testing.T) {
+	load := StepLoad(3, 1, 1.5)
+	assert.Equal(t, 1.0, load(0))
+	assert.Equal(t, 1.0, load(2))
+	assert.Equal(t, 1.5, load(3))
+	assert.Equal(t, 1.5, load(100))
+
+	assert.PanicsWithValue(t, "simulate: StepLoad steps must be positive, got 0", func() { StepLoad(0, 1) })
+	assert.PanicsWithValue(t, "simulate: StepLoad steps must be positive, got -1", func() { StepLoad(-1, 1) })
+	assert.PanicsWithValue(t, "simulate: StepLoad requires at least one factor", func() { StepLoad(1) })
+}
+
+func TestSimulator_Step(t *testing.T) {
+	quality := 10.0
+	cfg := DefaultConfig()
+	cfg.Metrics = []MetricSpec{{Name: "cpu", Target: 50, Utilization: true}}
+	cfg.Configs["quality"] = func() float64 { return quality }
+	cfg.Lag = 1
+
+	model := LinearModel(
+		map[lib.Metric]float64{"cpu": 0},
+		map[lib.Config]map[lib.Metric]float64{"quality": {"cpu": 6}},
+		nil,
+	)
+	simulator, err := NewSimulator(model, cfg)
+	assert.NoError(t, err)
+
+	var reports []v1alpha1.MetricReport
+	callback := func(ctx context.Context, report v1alpha1.MetricReport) {
+		reports = append(reports, report)
+		quality = 5
+	}
+
+	step := simulator.Step(context.TODO(), callback)
+	assert.Equal(t, 60.0, step.Metrics["cpu"])
+	assert.Equal(t, v1alpha1.Alert, step.Report[0].Type)
+	assert.Equal(t, int32(60), *step.Report[0].CurrentAverageUtilization)
+	assert.Equal(t, 5.0, step.Adjusted["quality"])
+
+	// The adjustment takes effect one step later
+	step = simulator.Step(context.TODO(), callback)
+	assert.Equal(t, 60.0, step.Metrics["cpu"])
+
+	step = simulator.Step(context.TODO(), callback)
+	assert.Equal(t, 30.0, step.Metrics["cpu"])
+	assert.Equal(t, v1alpha1.Cooldown, step.Report[0].Type)
+
+	step = simulator.Step(context.TODO(), callback)
+	assert.Empty(t, step.Report)
+	assert.Len(t, reports, 3)
+}
+
+func TestSimulator_Run_Controller(t *testing.T) {
+	controllerCfg := lib.DefaultControllerConfig()
+	controllerCfg.Logger = lib.NewDiscardLogger()
+	controller, err := lib.NewController(controllerCfg)
+	assert.NoError(t, err)
+
+	quality := int64(100)
+	tunable := lib.IntTunable("quality", func() int64 { return quality }, func(v int64) { quality = v })
+	tunable.Min = 0
+	tunable.Max = 100
+	tunable.DefaultStep = -10
+	assert.NoError(t, controller.Register(tunable))
+
+	cfg := DefaultConfig()
+	cfg.Metrics = []MetricSpec{{Name: "cpu", Target: 50, Utilization: true}}
+	cfg.Configs["quality"] = tunable.Get
+	cfg.Noise = 0.02
+	cfg.Correlator = controller.Correlator()
+
+	model := LinearModel(
+		map[lib.Metric]float64{"cpu": 10},
+		map[lib.Config]map[lib.Metric]float64{"quality": {"cpu": 0.8}},
+		StepLoad(10, 1, 1.2),
+	)
+	simulator, err := NewSimulator(model, cfg)
+	assert.NoError(t, err)
+
+	trace := simulator.Run(context.TODO(), controller.Handle, 40)
+	assert.Len(t, trace, 40)
+	assert.True(t, trace.Alerts() > 0)
+	assert.Less(t, trace.Last().Metrics["cpu"], 50*1.1, "controller keeps cpu around its target")
+	assert.Less(t, quality, int64(100))
+
+	var csv bytes.Buffer
+	assert.NoError(t, trace.WriteCSV(&csv))
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	assert.Len(t, lines, 41)
+	assert.Equal(t, "step,quality,cpu,cpu_alerting,quality_suggestion", lines[0])
+}
+
+func TestNewSimulator_Invalid(t *testing.T) {
+	model := LinearModel(nil, nil, nil)
+
+	_, err := NewSimulator(model)
+	assert.Error(t, err, "no metrics")
+
+	cfg := DefaultConfig()
+	cfg.Metrics = []MetricSpec{{Name: "cpu", Target: 50}}
+	cfg.Lag = -1
+	_, err = NewSimulator(model, cfg)
+	assert.Error(t, err)
+}
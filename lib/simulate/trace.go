@@ -0,0 +1,127 @@
+package simulate
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/wingsofovnia/metrics-webhook/lib"
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// TraceStep records a single simulated scrape or replayed report
+type TraceStep struct {
+	Step int
+	// Configs are the config values at the time of the report
+	Configs map[lib.Config]float64
+	// Metrics are the simulated metric values, empty for replayed reports
+	Metrics map[lib.Metric]float64
+	// Report is the report sent to the callback, if any
+	Report v1alpha1.MetricReport
+	// Suggestions are the correlator suggestions for the report, if traced
+	Suggestions lib.Suggestions
+	// Adjusted are the config values after the callback has returned
+	Adjusted map[lib.Config]float64
+}
+
+type Trace []TraceStep
+
+// Alerts counts the steps reporting alerts
+func (t Trace) Alerts() int {
+	alerts := 0
+	for _, step := range t {
+		if step.Report.HasAlerts() {
+			alerts++
+		}
+	}
+	return alerts
+}
+
+// Last returns the last step of the trace
+func (t Trace) Last() TraceStep {
+	if len(t) == 0 {
+		return TraceStep{}
+	}
+	return t[len(t)-1]
+}
+
+// WriteCSV writes the trace as CSV with a step column followed by a column per
+// config, metric, alerting metric flag and config suggestion, e.g. to be plotted
+func (t Trace) WriteCSV(w io.Writer) error {
+	configSet := make(map[string]bool)
+	metricSet := make(map[string]bool)
+	for _, step := range t {
+		for config := range step.Configs {
+			configSet[config] = true
+		}
+		for metric := range step.Metrics {
+			metricSet[metric] = true
+		}
+		for _, notification := range step.Report {
+			metricSet[notification.Name] = true
+		}
+	}
+	configs, metrics := sortedKeys(configSet), sortedKeys(metricSet)
+
+	header := []string{"step"}
+	header = append(header, configs...)
+	header = append(header, metrics...)
+	for _, metric := range metrics {
+		header = append(header, metric+"_alerting")
+	}
+	for _, config := range configs {
+		header = append(header, config+"_suggestion")
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, step := range t {
+		alerting := make(map[string]bool)
+		for _, notification := range step.Report {
+			alerting[notification.Name] = notification.Type == v1alpha1.Alert
+		}
+
+		record := []string{strconv.Itoa(step.Step)}
+		for _, config := range configs {
+			record = append(record, formatFloat(step.Configs[config]))
+		}
+		for _, metric := range metrics {
+			if value, set := step.Metrics[metric]; set {
+				record = append(record, formatFloat(value))
+			} else {
+				record = append(record, "")
+			}
+		}
+		for _, metric := range metrics {
+			record = append(record, strconv.FormatBool(alerting[metric]))
+		}
+		for _, config := range configs {
+			if suggestion, set := step.Suggestions[config]; set {
+				record = append(record, formatFloat(suggestion.Value))
+			} else {
+				record = append(record, "")
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
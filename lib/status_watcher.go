@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+type StatusWatcherConfig struct {
+	// ResyncPeriod is how often the watched MetricWebhook is relisted,
+	// 0 disables resyncs
+	ResyncPeriod time.Duration
+	// Logger logs watch failures and reports synthesized,
+	// defaults to the standard log package
+	Logger logr.Logger
+	// LogLevels sets the verbosity of reports synthesized
+	LogLevels LogLevels
+	// Metrics records reports synthesized and callback latencies,
+	// nil disables instrumentation
+	Metrics *Metrics
+}
+
+func DefaultStatusWatcherConfig() *StatusWatcherConfig {
+	return &StatusWatcherConfig{
+		ResyncPeriod: 10 * time.Minute,
+		LogLevels:    DefaultLogLevels(),
+	}
+}
+
+// StatusWatcher is a pull-mode alternative to WebhookServer for applications
+// that cannot accept inbound connections. It watches the status of a MetricWebhook
+// through the Kubernetes API and passes the callback the same Alert and Cooldown
+// reports the operator would POST. Cooldowns are only reported if the MetricWebhook
+// enables cooldownAlert. Metrics already alerting once the watch starts are
+// reported right away, so that a restarted application catches up.
+type StatusWatcher struct {
+	listWatch    cache.ListerWatcher
+	callback     Webhook
+	resyncPeriod time.Duration
+	logger       logr.Logger
+	logLevels    LogLevels
+	metrics      *Metrics
+
+	// last is the status reports have been synthesized against so far,
+	// only accessed by the informer handler goroutine
+	last *v1alpha1.MetricWebhook
+}
+
+// NewStatusWatcher creates a watcher of the MetricWebhook with the given name
+// and namespace, authenticated with restConfig (e.g. rest.InClusterConfig).
+// The application's service account needs get, list and watch permissions
+// on metricwebhooks.
+func NewStatusWatcher(restConfig *rest.Config, namespace, name string, callback Webhook, cfgs ...*StatusWatcherConfig) (*StatusWatcher, error) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.SchemeBuilder.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	clientCfg := rest.CopyConfig(restConfig)
+	clientCfg.GroupVersion = &v1alpha1.SchemeGroupVersion
+	clientCfg.APIPath = "/apis"
+	clientCfg.NegotiatedSerializer = serializer.NewCodecFactory(scheme).WithoutConversion()
+	if clientCfg.UserAgent == "" {
+		clientCfg.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	restClient, err := rest.RESTClientFor(clientCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MetricWebhook client: %v", err)
+	}
+
+	listWatch := cache.NewListWatchFromClient(restClient, "metricwebhooks", namespace,
+		fields.OneTermEqualSelector("metadata.name", name))
+	return newStatusWatcher(listWatch, callback, cfgs...), nil
+}
+
+func newStatusWatcher(listWatch cache.ListerWatcher, callback Webhook, cfgs ...*StatusWatcherConfig) *StatusWatcher {
+	var cfg *StatusWatcherConfig
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = DefaultStatusWatcherConfig()
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewStdLogger(0).WithName("watcher")
+	}
+
+	return &StatusWatcher{
+		listWatch:    listWatch,
+		callback:     callback,
+		resyncPeriod: cfg.ResyncPeriod,
+		logger:       logger,
+		logLevels:    cfg.LogLevels,
+		metrics:      cfg.Metrics,
+	}
+}
+
+// Run watches the MetricWebhook until ctx is done, passing ctx to callbacks.
+// Callbacks are never invoked concurrently. It fails if the MetricWebhook
+// cannot be listed initially, e.g. due to missing permissions.
+func (w *StatusWatcher) Run(ctx context.Context) error {
+	// Fail fast on missing permissions rather than let the informer retry forever
+	if _, err := w.listWatch.List(metav1.ListOptions{}); err != nil {
+		return fmt.Errorf("failed to list MetricWebhook: %v", err)
+	}
+
+	informer := cache.NewSharedInformer(w.listWatch, &v1alpha1.MetricWebhook{}, w.resyncPeriod)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.observe(ctx, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			w.observe(ctx, obj)
+		},
+		DeleteFunc: func(interface{}) {
+			w.withdraw(ctx)
+		},
+	})
+
+	informer.Run(ctx.Done())
+	return nil
+}
+
+func (w *StatusWatcher) observe(ctx context.Context, obj interface{}) {
+	metricWebhook, ok := obj.(*v1alpha1.MetricWebhook)
+	if !ok {
+		return
+	}
+
+	report := statusReport(w.last, metricWebhook, time.Now())
+	w.last = metricWebhook.DeepCopy()
+	w.report(ctx, report)
+}
+
+// withdraw reports the metrics alerting as of the last observed status as
+// withdrawn once the MetricWebhook is deleted
+func (w *StatusWatcher) withdraw(ctx context.Context) {
+	if w.last == nil {
+		return
+	}
+	deleted := &v1alpha1.MetricWebhook{Spec: w.last.Spec}
+	report := statusReport(w.last, deleted, time.Now())
+	w.last = nil
+	w.report(ctx, report)
+}
+
+func (w *StatusWatcher) report(ctx context.Context, report v1alpha1.MetricReport) {
+	if len(report) == 0 {
+		return
+	}
+
+	w.logger.V(w.logLevels.Reports).Info("synthesized metric report", reportValues(report)...)
+	w.metrics.observeReport(report)
+
+	start := time.Now()
+	w.callback(ctx, report)
+	w.metrics.observeCallback("processed", start)
+}
+
+// statusReport mirrors the reports the operator sends on status changes,
+// as of now. A metric alerts each time it is scraped above its target and
+// cools down once it is scraped below its target after alerting. With no
+// previous status, metrics currently alerting are reported. Metrics failed
+// to be fetched are reported as the failure policy defines, NoData once they
+// start failing. Regardless of the policy, metrics failing for longer than
+// staleAfter are reported NoData and metrics keeping a sample older than
+// staleAfter are reported Stale, each time the status is observed, as the
+// operator does on each scrape. Metrics alerting before they have been removed
+// from the status are withdrawn. Nothing but the withdrawal of the metrics
+// alerting once the mode leaves Active is reported in DryRun and Suspended
+// modes. Leaving DryRun mode is reported as if there were no previous status.
+func statusReport(prev, curr *v1alpha1.MetricWebhook, now time.Time) v1alpha1.MetricReport {
+	if !curr.Spec.Mode.IsActive() {
+		if prev == nil || !prev.Spec.Mode.IsActive() {
+			return nil
+		}
+		var withdrawn v1alpha1.MetricReport
+		for _, metric := range prev.Status.Metrics {
+			if metric.Alerting {
+				withdrawn = append(withdrawn, v1alpha1.NewMetricNotification(v1alpha1.Withdrawn, metric))
+			}
+		}
+		return withdrawn
+	}
+	if prev != nil && prev.Spec.Mode == v1alpha1.DryRunMode {
+		prev = nil
+	}
+
+	staleAfter := curr.Spec.StaleAfter.Duration
+	if staleAfter == 0 {
+		staleAfter = v1alpha1.DefaultStaleAfter
+	}
+
+	prevMetrics := make(map[string]v1alpha1.MetricStatus)
+	if prev != nil {
+		for _, metric := range prev.Status.Metrics {
+			prevMetrics[metric.MetricName()] = metric
+		}
+	}
+
+	var alerts, cooldowns, noData, stale, withdrawn v1alpha1.MetricReport
+	for _, metric := range curr.Status.Metrics {
+		prevMetric, known := prevMetrics[metric.MetricName()]
+		delete(prevMetrics, metric.MetricName())
+		if metric.Error != "" {
+			switch {
+			case now.Sub(lastSuccessfulScrape(curr, metric)) > staleAfter,
+				curr.Spec.FailurePolicy == v1alpha1.NoDataFailurePolicy && (!known || prevMetric.Error == ""):
+				noData = append(noData, v1alpha1.NewMetricNotification(v1alpha1.NoData, metric))
+			case curr.Spec.FailurePolicy == v1alpha1.KeepLastFailurePolicy && metric.Alerting:
+				alerts = append(alerts, v1alpha1.NewMetricNotification(v1alpha1.Alert, metric))
+			}
+			continue
+		}
+		if now.Sub(metric.ScrapeTime.Time) > staleAfter {
+			stale = append(stale, v1alpha1.NewMetricNotification(v1alpha1.Stale, metric))
+		}
+		if known && prevMetric.ScrapeTime.Equal(&metric.ScrapeTime) {
+			// New metric values have not arrived yet
+			continue
+		}
+
+		switch {
+		case metric.Alerting:
+			alerts = append(alerts, v1alpha1.NewMetricNotification(v1alpha1.Alert, metric))
+		case known && prevMetric.Alerting && curr.Spec.CooldownAlert:
+			cooldowns = append(cooldowns, v1alpha1.NewMetricNotification(v1alpha1.Cooldown, metric))
+		}
+	}
+	if prev != nil {
+		for _, metric := range prev.Status.Metrics {
+			if _, removed := prevMetrics[metric.MetricName()]; removed && metric.Alerting {
+				withdrawn = append(withdrawn, v1alpha1.NewMetricNotification(v1alpha1.Withdrawn, metric))
+			}
+		}
+	}
+	return append(append(append(append(alerts, cooldowns...), noData...), stale...), withdrawn...)
+}
+
+// lastSuccessfulScrape is the last time the metric has been fetched, or the
+// creation time of the MetricWebhook if it has never been fetched
+func lastSuccessfulScrape(metricWebhook *v1alpha1.MetricWebhook, metric v1alpha1.MetricStatus) time.Time {
+	if metric.LastSuccessfulScrape != nil {
+		return metric.LastSuccessfulScrape.Time
+	}
+	return metricWebhook.CreationTimestamp.Time
+}
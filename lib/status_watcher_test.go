@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func statusWebhook(version string, cooldown bool, alerting bool, utilization int32, scrapeTime time.Time) *v1alpha1.MetricWebhook {
+	target := int32(50)
+	return &v1alpha1.MetricWebhook{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", ResourceVersion: version,
+			CreationTimestamp: metav1.NewTime(scrapeTime)},
+		Spec: v1alpha1.MetricWebhookSpec{CooldownAlert: cooldown},
+		Status: v1alpha1.MetricWebhookStatus{
+			Metrics: []v1alpha1.MetricStatus{{
+				Type:     v1alpha1.ResourceMetricSourceType,
+				Alerting: alerting,
+				Resource: &v1alpha1.ResourceMetricStatus{
+					Name:                      "cpu",
+					CurrentAverageUtilization: &utilization,
+					TargetAverageUtilization:  &target,
+				},
+				ScrapeTime: metav1.NewTime(scrapeTime),
+			}},
+		},
+	}
+}
+
+func TestStatusReport(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+
+	alerting := statusWebhook("1", true, true, 80, scrape)
+	report := statusReport(nil, alerting, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Alert, report[0].Type)
+	assert.Equal(t, "cpu", report[0].Name)
+	assert.Equal(t, int32(80), *report[0].CurrentAverageUtilization)
+
+	// Same scrape, no new values
+	assert.Empty(t, statusReport(alerting, statusWebhook("2", true, true, 80, scrape), scrape))
+
+	// Alerting again on the next scrape
+	stillAlerting := statusWebhook("3", true, true, 70, scrape.Add(time.Minute))
+	assert.Len(t, statusReport(alerting, stillAlerting, scrape), 1)
+
+	// Cools down only if enabled
+	cooledDown := statusWebhook("4", true, false, 40, scrape.Add(2*time.Minute))
+	report = statusReport(stillAlerting, cooledDown, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Cooldown, report[0].Type)
+
+	cooledDown.Spec.CooldownAlert = false
+	assert.Empty(t, statusReport(stillAlerting, cooledDown, scrape))
+
+	// Not alerting after not alerting
+	assert.Empty(t, statusReport(cooledDown, statusWebhook("5", true, false, 30, scrape.Add(3*time.Minute)), scrape))
+	assert.Empty(t, statusReport(nil, cooledDown, scrape))
+}
+
+func TestStatusReport_FailurePolicy(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+
+	alerting := statusWebhook("1", false, true, 80, scrape)
+	failing := statusWebhook("2", false, true, 80, scrape)
+	failing.Status.Metrics[0].Error = "metrics not available yet"
+
+	assert.Empty(t, statusReport(alerting, failing, scrape))
+
+	failing.Spec.FailurePolicy = v1alpha1.KeepLastFailurePolicy
+	report := statusReport(alerting, failing, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Alert, report[0].Type)
+
+	failing.Spec.FailurePolicy = v1alpha1.NoDataFailurePolicy
+	report = statusReport(alerting, failing, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.NoData, report[0].Type)
+	assert.False(t, report[0].HasData())
+
+	// Reported once the metric starts failing only
+	assert.Empty(t, statusReport(failing, failing, scrape))
+}
+
+func TestStatusReport_StaleAfter(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+	staleAfter := v1alpha1.DefaultStaleAfter
+
+	alerting := statusWebhook("1", false, true, 80, scrape)
+	failing := statusWebhook("2", false, true, 80, scrape)
+	failing.Status.Metrics[0].Error = "metrics not available yet"
+
+	// NoData once failing for longer than staleAfter regardless of the policy
+	for _, policy := range []v1alpha1.MetricFailurePolicy{"", v1alpha1.IgnoreFailurePolicy, v1alpha1.KeepLastFailurePolicy} {
+		failing.Spec.FailurePolicy = policy
+		report := statusReport(failing, failing, scrape.Add(staleAfter+time.Second))
+		assert.Len(t, report, 1, policy)
+		assert.Equal(t, v1alpha1.NoData, report[0].Type, policy)
+	}
+
+	// Measured since the last successful scrape rather than creation, if any
+	lastSuccessfulScrape := metav1.NewTime(scrape.Add(time.Minute))
+	failing.Status.Metrics[0].LastSuccessfulScrape = &lastSuccessfulScrape
+	failing.Spec.FailurePolicy = v1alpha1.IgnoreFailurePolicy
+	assert.Empty(t, statusReport(alerting, failing, scrape.Add(staleAfter+time.Second)))
+	failing.Spec.StaleAfter = metav1.Duration{Duration: time.Minute}
+	assert.Len(t, statusReport(alerting, failing, scrape.Add(2*time.Minute+time.Second)), 1)
+
+	// Stale for samples older than staleAfter, on each observation
+	report := statusReport(alerting, alerting, scrape.Add(staleAfter+time.Second))
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Stale, report[0].Type)
+	assert.True(t, report.HasMissingData())
+	assert.Empty(t, statusReport(alerting, alerting, scrape.Add(staleAfter)))
+}
+
+func TestStatusReport_Withdrawn(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+
+	alerting := statusWebhook("1", false, true, 80, scrape)
+	removed := statusWebhook("2", false, true, 80, scrape)
+	removed.Status.Metrics = nil
+
+	report := statusReport(alerting, removed, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Withdrawn, report[0].Type)
+	assert.True(t, report.IsWithdrawn())
+
+	// Metrics not alerting are removed silently
+	assert.Empty(t, statusReport(statusWebhook("3", false, false, 40, scrape), removed, scrape))
+}
+
+func TestStatusReport_DryRun(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+
+	dryRun := statusWebhook("1", true, true, 80, scrape)
+	dryRun.Spec.Mode = v1alpha1.DryRunMode
+	assert.Empty(t, statusReport(nil, dryRun, scrape))
+
+	dryRunCooledDown := statusWebhook("2", true, false, 40, scrape.Add(time.Minute))
+	dryRunCooledDown.Spec.Mode = v1alpha1.DryRunMode
+	assert.Empty(t, statusReport(dryRun, dryRunCooledDown, scrape))
+
+	// Metrics alerting once active are reported right away, no cooldowns for dry run alerts
+	active := statusWebhook("3", true, true, 80, scrape.Add(time.Minute))
+	active.Spec.Mode = v1alpha1.ActiveMode
+	report := statusReport(dryRun, active, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Alert, report[0].Type)
+
+	assert.Empty(t, statusReport(dryRun, statusWebhook("4", true, false, 40, scrape.Add(2*time.Minute)), scrape))
+
+	// Alerts are withdrawn once the mode leaves Active
+	suspended := statusWebhook("5", true, true, 80, scrape.Add(time.Minute))
+	suspended.Spec.Mode = v1alpha1.SuspendedMode
+	report = statusReport(active, suspended, scrape)
+	assert.Len(t, report, 1)
+	assert.Equal(t, v1alpha1.Withdrawn, report[0].Type)
+	assert.Empty(t, statusReport(suspended, suspended, scrape))
+	assert.Empty(t, statusReport(dryRun, suspended, scrape))
+}
+
+func TestStatusWatcher_Run(t *testing.T) {
+	scrape := time.Now().Truncate(time.Second)
+	watcher := watch.NewFake()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &v1alpha1.MetricWebhookList{
+				ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+				Items:    []v1alpha1.MetricWebhook{*statusWebhook("1", true, true, 80, scrape)},
+			}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}
+
+	reports := make(chan v1alpha1.MetricReport, 10)
+	cfg := DefaultStatusWatcherConfig()
+	cfg.Logger = NewDiscardLogger()
+	statusWatcher := newStatusWatcher(listWatch, func(ctx context.Context, report v1alpha1.MetricReport) {
+		reports <- report
+	}, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- statusWatcher.Run(ctx)
+	}()
+
+	select {
+	case report := <-reports:
+		assert.Equal(t, v1alpha1.Alert, report[0].Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report for the initial alerting status")
+	}
+
+	watcher.Modify(statusWebhook("2", true, false, 40, scrape.Add(time.Minute)))
+	select {
+	case report := <-reports:
+		assert.Equal(t, v1alpha1.Cooldown, report[0].Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report for the cooldown status")
+	}
+
+	watcher.Modify(statusWebhook("3", true, true, 90, scrape.Add(2*time.Minute)))
+	<-reports
+	watcher.Delete(statusWebhook("3", true, true, 90, scrape.Add(2*time.Minute)))
+	select {
+	case report := <-reports:
+		assert.Equal(t, v1alpha1.Withdrawn, report[0].Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report for the deleted MetricWebhook")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not stop")
+	}
+}
+
+func TestStatusWatcher_Run_ListFailure(t *testing.T) {
+	listWatch := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return nil, fmt.Errorf("forbidden")
+		},
+	}
+	statusWatcher := newStatusWatcher(listWatch, func(context.Context, v1alpha1.MetricReport) {})
+	assert.Error(t, statusWatcher.Run(context.Background()))
+}
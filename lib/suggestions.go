@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"math"
+)
+
+// Suggestion is an adjustment of a Config suggested by AdjustmentCorrelator
+// together with the statistics describing how much the suggestion can be trusted.
+type Suggestion struct {
+	// Value is the suggested change of the Config value, kept within
+	// the constraints of the config if registered
+	Value float64
+	// Desired is the change of the Config value needed to meet metric targets
+	// regardless of the config constraints
+	Desired float64
+	// BlockedBy names the constraint that prevents Value from being
+	// the Desired one, if any
+	BlockedBy Bound
+	// Recovery flags suggestions restoring the config towards its preferred
+	// value rather than improving alerting metrics
+	Recovery bool
+	// Samples is the number of observed adjustment rounds the suggestion
+	// has been learned from
+	Samples int
+	// Variance is the estimated variance of the suggested Value
+	Variance float64
+	// Lower and Upper bound the 95% confidence interval of the Desired value.
+	// The interval is unbounded if learned from less than two samples.
+	Lower float64
+	Upper float64
+}
+
+type Suggestions map[Config]Suggestion
+
+// newSuggestion estimates how much a Config needs to change to improve metric
+// value by targetImprovement given the average per-unit improvement (correlation)
+// observed before. The variance of the suggestion is propagated from the
+// variance of the correlation using the delta method, i.e. Var(t/c) ≈ (t/c²)² Var(c).
+func newSuggestion(correlation AverageMeasurement, targetImprovement Measurement, scale float64) Suggestion {
+	value := correlation.Value.GoesInto(targetImprovement) * scale
+
+	standardError := correlation.StandardError()
+	componentVariance := func(target, mean, standardError float64) float64 {
+		derivative := target / (mean * mean)
+		return derivative * derivative * standardError * standardError
+	}
+
+	// Mirrors the components Measurement.GoesInto takes into account
+	useUtilization := correlation.Value.Utilization != 0 && targetImprovement.Utilization != 0
+	useValue := correlation.Value.Value != 0 && targetImprovement.Value != 0
+
+	var variance float64
+	switch {
+	case useUtilization && useValue:
+		variance = (componentVariance(targetImprovement.Utilization, correlation.Value.Utilization, standardError.Utilization) +
+			componentVariance(targetImprovement.Value, correlation.Value.Value, standardError.Value)) / 4
+	case useUtilization:
+		variance = componentVariance(targetImprovement.Utilization, correlation.Value.Utilization, standardError.Utilization)
+	case useValue:
+		variance = componentVariance(targetImprovement.Value, correlation.Value.Value, standardError.Value)
+	}
+	variance = variance * scale * scale
+
+	halfWidth := studentT95(correlation.Among-1) * math.Sqrt(variance)
+	return Suggestion{
+		Value:    value,
+		Desired:  value,
+		Samples:  correlation.Among,
+		Variance: variance,
+		Lower:    value - halfWidth,
+		Upper:    value + halfWidth,
+	}
+}
+
+// Blocked tells whether config constraints prevent the Desired adjustment
+func (s Suggestion) Blocked() bool {
+	return s.BlockedBy != NoBound
+}
+
+// RelativeError is the half-width of the confidence interval relative to
+// the suggested value, e.g. 0.1 means the true value is likely within ±10%.
+func (s Suggestion) RelativeError() float64 {
+	if s.Desired == 0 {
+		return math.Inf(1)
+	}
+	return (s.Upper - s.Lower) / 2 / math.Abs(s.Desired)
+}
+
+// Adjustments returns suggested values regardless of their confidence
+func (s Suggestions) Adjustments() Adjustments {
+	adjustments := make(Adjustments)
+	for config, suggestion := range s {
+		adjustments[config] = suggestion.Value
+	}
+	return adjustments
+}
+
+// Confident returns suggested values learned from at least minSamples rounds
+// and those relative error does not exceed maxRelativeError
+func (s Suggestions) Confident(minSamples int, maxRelativeError float64) Adjustments {
+	adjustments := make(Adjustments)
+	for config, suggestion := range s {
+		if suggestion.Samples < minSamples || suggestion.RelativeError() > maxRelativeError {
+			continue
+		}
+		adjustments[config] = suggestion.Value
+	}
+	return adjustments
+}
@@ -0,0 +1,335 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Webhook is a callback processing metric reports. The context is cancelled
+// if the webhook server fails to drain in-flight callbacks on shutdown in time.
+type Webhook func(ctx context.Context, report v1alpha1.MetricReport)
+
+// CallbackMode defines how Webhook callbacks are invoked when several
+// reports arrive at once
+type CallbackMode int
+
+const (
+	// CoalesceCallbacks runs one callback at a time. Reports arriving while
+	// a callback runs are dropped except for the latest one, that is processed
+	// right after the running callback returns. All of them are answered with
+	// 202 on arrival, so a 202 does not guarantee the report gets processed.
+	CoalesceCallbacks CallbackMode = iota
+	// SerializeCallbacks runs one callback at a time, every report is processed
+	SerializeCallbacks
+	// ConcurrentCallbacks runs callbacks for each report concurrently
+	ConcurrentCallbacks
+)
+
+// FallibleWebhook is a Webhook callback that reports whether the application
+// managed to process the report. Errors are answered with 5xx statuses, so
+// that the operator may retry the delivery, unless marked with Permanent,
+// that are answered with 422. Returning ErrAccepted answers 202, e.g. if the
+// report is going to be processed asynchronously.
+type FallibleWebhook func(ctx context.Context, report v1alpha1.MetricReport) error
+
+// ErrAccepted tells the report has been accepted for processing later on,
+// or, with CoalesceCallbacks, for being superseded by a later report
+var ErrAccepted = errors.New("report accepted for processing")
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a FallibleWebhook error as the one delivering
+// the same report again will not resolve
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent tells whether the error has been marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Fallible adapts the Webhook to a FallibleWebhook that never fails
+func (callback Webhook) Fallible() FallibleWebhook {
+	return func(ctx context.Context, report v1alpha1.MetricReport) error {
+		callback(ctx, report)
+		return nil
+	}
+}
+
+// SerializedWebhook wraps the callback so that it is never invoked concurrently
+func SerializedWebhook(callback Webhook) Webhook {
+	serialized := serialized(callback.Fallible())
+	return func(ctx context.Context, report v1alpha1.MetricReport) {
+		_ = serialized(ctx, report)
+	}
+}
+
+// CoalescedWebhook wraps the callback so that it is never invoked concurrently
+// and only the latest of the reports arrived meanwhile is processed. The latest
+// report is processed with the context of the invocation that was running.
+func CoalescedWebhook(callback Webhook) Webhook {
+	coalesced := coalesced(callback.Fallible(), NewStdLogger(0).WithName("webhook"))
+	return func(ctx context.Context, report v1alpha1.MetricReport) {
+		_ = coalesced(ctx, report)
+	}
+}
+
+func serialized(callback FallibleWebhook) FallibleWebhook {
+	var mu sync.Mutex
+	return func(ctx context.Context, report v1alpha1.MetricReport) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return callback(ctx, report)
+	}
+}
+
+// coalesced returns ErrAccepted for reports deferred while another one is being
+// processed. Deferred reports superseded by later ones are logged as dropped.
+// Errors of processing deferred reports are only logged, as their requests
+// have been answered already.
+func coalesced(callback FallibleWebhook, logger logr.Logger) FallibleWebhook {
+	var mu sync.Mutex
+	var running bool
+	var pending *v1alpha1.MetricReport
+
+	return func(ctx context.Context, report v1alpha1.MetricReport) error {
+		mu.Lock()
+		if running {
+			if pending != nil {
+				logger.Info("dropped deferred metric report superseded by a later one", reportValues(*pending)...)
+			}
+			pending = &report
+			mu.Unlock()
+			return ErrAccepted
+		}
+		running = true
+		mu.Unlock()
+
+		var ownErr error
+		for own := true; ; own = false {
+			err := func() error {
+				// Stay ready for the next reports even if the callback panics
+				defer func() {
+					if r := recover(); r != nil {
+						mu.Lock()
+						running = false
+						pending = nil
+						mu.Unlock()
+						panic(r)
+					}
+				}()
+				return callback(ctx, report)
+			}()
+			if own {
+				ownErr = err
+			} else if err != nil && !errors.Is(err, ErrAccepted) {
+				logger.Error(err, "failed to process deferred metric report")
+			}
+
+			mu.Lock()
+			if pending == nil {
+				running = false
+				mu.Unlock()
+				return ownErr
+			}
+			report = *pending
+			pending = nil
+			mu.Unlock()
+		}
+	}
+}
+
+// Middleware wraps the webhook handler, e.g. to authenticate, log or limit requests
+type Middleware func(http.Handler) http.Handler
+
+type WebhookHandlerConfig struct {
+	// CallbackMode defines how callbacks are invoked for concurrent requests
+	CallbackMode CallbackMode
+	// MaxBodyBytes limits the size of metric reports accepted, 0 disables the limit
+	MaxBodyBytes int64
+	// Middlewares wrap the handler, the first one being the outermost
+	Middlewares []Middleware
+	// Logger logs decoding failures, callback errors and reports received,
+	// defaults to the standard log package
+	Logger logr.Logger
+	// LogLevels sets the verbosity of reports received
+	LogLevels LogLevels
+	// Metrics records reports received, decoding failures and callback
+	// latencies, nil disables instrumentation
+	Metrics *Metrics
+}
+
+func DefaultWebhookHandlerConfig() *WebhookHandlerConfig {
+	return &WebhookHandlerConfig{
+		CallbackMode: CoalesceCallbacks,
+		MaxBodyBytes: 1 << 20,
+		LogLevels:    DefaultLogLevels(),
+	}
+}
+
+// WebhookHandler is an http.Handler decoding metric reports POSTed by the
+// operator and passing them to the callback. It can be mounted on any router,
+// so that applications do not need a separate server for metric alerts.
+type WebhookHandler struct {
+	callback     FallibleWebhook
+	maxBodyBytes int64
+	handler      http.Handler
+	logger       logr.Logger
+	logLevels    LogLevels
+	metrics      *Metrics
+
+	// callbackCtx replaces request contexts in callbacks if set
+	callbackCtx context.Context
+}
+
+func NewWebhookHandler(callback Webhook, cfgs ...*WebhookHandlerConfig) *WebhookHandler {
+	return NewFallibleWebhookHandler(callback.Fallible(), cfgs...)
+}
+
+// NewFallibleWebhookHandler creates a handler that answers with the status
+// matching the callback outcome, see FallibleWebhook
+func NewFallibleWebhookHandler(callback FallibleWebhook, cfgs ...*WebhookHandlerConfig) *WebhookHandler {
+	var cfg *WebhookHandlerConfig
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = DefaultWebhookHandlerConfig()
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewStdLogger(0).WithName("webhook")
+	}
+
+	switch cfg.CallbackMode {
+	case CoalesceCallbacks:
+		callback = coalesced(callback, logger)
+	case SerializeCallbacks:
+		callback = serialized(callback)
+	}
+
+	h := &WebhookHandler{
+		callback:     callback,
+		maxBodyBytes: cfg.MaxBodyBytes,
+		logger:       logger,
+		logLevels:    cfg.LogLevels,
+		metrics:      cfg.Metrics,
+	}
+
+	var handler http.Handler = http.HandlerFunc(h.serveReport)
+	for i := len(cfg.Middlewares) - 1; i >= 0; i-- {
+		handler = cfg.Middlewares[i](handler)
+	}
+	h.handler = handler
+
+	return h
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *WebhookHandler) serveReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := r.Body
+	if h.maxBodyBytes > 0 {
+		if r.ContentLength > h.maxBodyBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	}
+
+	decoder := json.NewDecoder(body)
+	var report v1alpha1.MetricReport
+	err := decoder.Decode(&report)
+	if err != nil {
+		h.logger.Error(err, "failed to decode metric report", "remoteAddr", r.RemoteAddr)
+		h.metrics.observeDecodeFailure()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.logger.V(h.logLevels.Reports).Info("received metric report", reportValues(report)...)
+	h.metrics.observeReport(report)
+
+	ctx := r.Context()
+	if h.callbackCtx != nil {
+		ctx = h.callbackCtx
+	}
+
+	start := time.Now()
+	err = h.callback(ctx, report)
+	switch {
+	case err == nil:
+		h.metrics.observeCallback("processed", start)
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, ErrAccepted):
+		h.metrics.observeCallback("accepted", start)
+		w.WriteHeader(http.StatusAccepted)
+	case IsPermanent(err):
+		h.metrics.observeCallback("rejected", start)
+		h.logger.Error(err, "failed to process metric report", "permanent", true)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		h.metrics.observeCallback("failed", start)
+		h.logger.Error(err, "failed to process metric report", "permanent", false)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+// BearerTokenAuth rejects requests not authorized with the given bearer token
+func BearerTokenAuth(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MaxConcurrentRequests rejects requests above the given number of
+// requests being served at once
+func MaxConcurrentRequests(limit int) Middleware {
+	return func(next http.Handler) http.Handler {
+		slots := make(chan struct{}, limit)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(w, r)
+			default:
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestCoalescedWebhook(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+
+	var mu sync.Mutex
+	var processed []string
+	webhook := CoalescedWebhook(func(ctx context.Context, report v1alpha1.MetricReport) {
+		started <- struct{}{}
+		<-release
+
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, report[0].Name)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		webhook(context.TODO(), v1alpha1.MetricReport{{Name: "first"}})
+		close(done)
+	}()
+	<-started
+
+	// Arrive while the first one is being processed, only the latest survives
+	webhook(context.TODO(), v1alpha1.MetricReport{{Name: "second"}})
+	webhook(context.TODO(), v1alpha1.MetricReport{{Name: "third"}})
+	webhook(context.TODO(), v1alpha1.MetricReport{{Name: "fourth"}})
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("coalesced webhook has not returned")
+	}
+	assert.Equal(t, []string{"first", "fourth"}, processed)
+}
+
+func TestSerializedWebhook(t *testing.T) {
+	var running, maxRunning, calls int
+	var mu sync.Mutex
+	webhook := SerializedWebhook(func(ctx context.Context, report v1alpha1.MetricReport) {
+		mu.Lock()
+		running++
+		calls++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			webhook(context.TODO(), v1alpha1.MetricReport{})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, calls)
+	assert.Equal(t, 1, maxRunning)
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var reports []v1alpha1.MetricReport
+	handler := NewWebhookHandler(func(ctx context.Context, report v1alpha1.MetricReport) {
+		reports = append(reports, report)
+	})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/", strings.NewReader("{malformed")))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/", strings.NewReader(`[{"type":"Alert","name":"cpu"}]`)))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, v1alpha1.Alert, reports[0][0].Type)
+	assert.Equal(t, "cpu", reports[0][0].Name)
+}
+
+func TestWebhookHandler_Config(t *testing.T) {
+	var calls int
+	var order []string
+	tracing := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	cfg := DefaultWebhookHandlerConfig()
+	cfg.MaxBodyBytes = 16
+	cfg.Middlewares = []Middleware{tracing("outer"), BearerTokenAuth("secret"), tracing("inner")}
+	handler := NewWebhookHandler(func(ctx context.Context, report v1alpha1.MetricReport) {
+		calls++
+	}, cfg)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/", strings.NewReader("[]")))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, []string{"outer"}, order)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("[]"))
+	req.Header.Set("Authorization", "Bearer secret")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, []string{"outer", "outer", "inner"}, order)
+	assert.Equal(t, 1, calls)
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`[{"type":"Alert","name":"cpu"}]`))
+	req.Header.Set("Authorization", "Bearer secret")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFallibleWebhookHandler(t *testing.T) {
+	outcomes := map[string]error{
+		"ok":        nil,
+		"accepted":  ErrAccepted,
+		"permanent": Permanent(errors.New("invalid report")),
+		"retryable": errors.New("failed to apply adjustments"),
+	}
+	cfg := DefaultWebhookHandlerConfig()
+	cfg.CallbackMode = ConcurrentCallbacks
+	handler := NewFallibleWebhookHandler(func(ctx context.Context, report v1alpha1.MetricReport) error {
+		return outcomes[report[0].Name]
+	}, cfg)
+
+	expectedStatuses := map[string]int{
+		"ok":        http.StatusOK,
+		"accepted":  http.StatusAccepted,
+		"permanent": http.StatusUnprocessableEntity,
+		"retryable": http.StatusServiceUnavailable,
+	}
+	for name, expectedStatus := range expectedStatuses {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("POST", "/", strings.NewReader(`[{"name":"`+name+`"}]`)))
+		assert.Equal(t, expectedStatus, res.Code, name)
+	}
+
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", Permanent(errors.New("invalid report")))))
+	assert.False(t, IsPermanent(errors.New("failed to apply adjustments")))
+	assert.Nil(t, Permanent(nil))
+}
+
+func TestFallibleWebhookHandler_Coalesced(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handler := NewFallibleWebhookHandler(func(ctx context.Context, report v1alpha1.MetricReport) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, httptest.NewRequest("POST", "/", strings.NewReader("[]")))
+		close(done)
+	}()
+	<-started
+
+	// Deferred until the running callback returns
+	deferred := httptest.NewRecorder()
+	handler.ServeHTTP(deferred, httptest.NewRequest("POST", "/", strings.NewReader("[]")))
+	assert.Equal(t, http.StatusAccepted, deferred.Code)
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	<-done
+	assert.Equal(t, http.StatusOK, first.Code)
+}
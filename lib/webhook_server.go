@@ -2,37 +2,27 @@ package lib
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-logr/logr"
+
 	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
 )
 
-type Webhook func(report v1alpha1.MetricReport)
-
-var WebhookHandler = func(callback Webhook) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		decoder := json.NewDecoder(r.Body)
-		var report v1alpha1.MetricReport
-		err := decoder.Decode(&report)
-		if err != nil {
-			log.Printf("[Webhook] ERR: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		callback(report)
-	}
-}
-
 type WebhookServer struct {
-	httpServer *http.Server
+	httpServer      *http.Server
+	logger          logr.Logger
+	shutdownTimeout time.Duration
+	ready           int32
+
+	// callbackCtx outlives webhook requests, so that callbacks are not cancelled
+	// once the operator stops waiting for the response, but only on shutdown
+	callbackCtx     context.Context
+	cancelCallbacks context.CancelFunc
 }
 
 type WebhookServerConfig struct {
@@ -41,19 +31,43 @@ type WebhookServerConfig struct {
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 	WebhookPath  string
+	// Handler configures the webhook handler serving WebhookPath
+	Handler *WebhookHandlerConfig
+	// HealthPath serves liveness probes, responds OK as long as the server serves
+	HealthPath string
+	// ReadinessPath serves readiness probes, responds OK only after the server
+	// started listening and until it begins to shut down
+	ReadinessPath string
+	// ShutdownTimeout limits how long Serve waits for in-flight
+	// callbacks to finish once its context is done
+	ShutdownTimeout time.Duration
+	// Logger logs the server lifecycle. It is also used by the webhook
+	// handler unless the Handler config sets its own one.
+	Logger logr.Logger
 }
 
 func DefaultWebhookServerConfig() *WebhookServerConfig {
 	return &WebhookServerConfig{
-		Addr:         ":4030",
-		ReadTimeout:  time.Second * 15,
-		WriteTimeout: time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		WebhookPath:  "/metrics-webhook",
+		Addr:            fmt.Sprintf(":%d", v1alpha1.DefaultWebhookPort),
+		ReadTimeout:     time.Second * 15,
+		WriteTimeout:    time.Second * 15,
+		IdleTimeout:     time.Second * 60,
+		WebhookPath:     v1alpha1.DefaultWebhookPath,
+		Handler:         DefaultWebhookHandlerConfig(),
+		HealthPath:      "/healthz",
+		ReadinessPath:   "/readyz",
+		ShutdownTimeout: time.Second * 15,
+		Logger:          NewStdLogger(0).WithName("webhook"),
 	}
 }
 
 func NewWebhookServer(callback Webhook, cfgs ...*WebhookServerConfig) *WebhookServer {
+	return NewFallibleWebhookServer(callback.Fallible(), cfgs...)
+}
+
+// NewFallibleWebhookServer creates a server that answers webhook requests
+// with the status matching the callback outcome, see FallibleWebhook
+func NewFallibleWebhookServer(callback FallibleWebhook, cfgs ...*WebhookServerConfig) *WebhookServer {
 	var cfg *WebhookServerConfig
 	if len(cfgs) > 0 && cfgs[0] != nil {
 		cfg = cfgs[0]
@@ -61,29 +75,107 @@ func NewWebhookServer(callback Webhook, cfgs ...*WebhookServerConfig) *WebhookSe
 		cfg = DefaultWebhookServerConfig()
 	}
 
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewStdLogger(0).WithName("webhook")
+	}
+
+	srv := &WebhookServer{
+		shutdownTimeout: cfg.ShutdownTimeout,
+		logger:          logger,
+	}
+	srv.callbackCtx, srv.cancelCallbacks = context.WithCancel(context.Background())
+
+	handlerCfg := DefaultWebhookHandlerConfig()
+	if cfg.Handler != nil {
+		handlerCfg = cfg.Handler
+	}
+	if handlerCfg.Logger == nil {
+		handlerCfgCopy := *handlerCfg
+		handlerCfgCopy.Logger = logger
+		handlerCfg = &handlerCfgCopy
+	}
+	webhookHandler := NewFallibleWebhookHandler(callback, handlerCfg)
+	webhookHandler.callbackCtx = srv.callbackCtx
+
 	router := http.NewServeMux()
-	router.HandleFunc(cfg.WebhookPath, WebhookHandler(callback))
-
-	return &WebhookServer{
-		httpServer: &http.Server{
-			Addr:         cfg.Addr,
-			WriteTimeout: cfg.WriteTimeout,
-			ReadTimeout:  cfg.ReadTimeout,
-			IdleTimeout:  cfg.IdleTimeout,
-			Handler:      router,
-		},
+	router.Handle(cfg.WebhookPath, webhookHandler)
+	if cfg.HealthPath != "" {
+		router.HandleFunc(cfg.HealthPath, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+	if cfg.ReadinessPath != "" {
+		router.HandleFunc(cfg.ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+			if !srv.Ready() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	srv.httpServer = &http.Server{
+		Addr:         cfg.Addr,
+		WriteTimeout: cfg.WriteTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		Handler:      router,
+	}
+	return srv
+}
+
+// Serve listens on the configured address and serves webhook requests until
+// ctx is done, then shuts the server down gracefully waiting for in-flight
+// callbacks up to ShutdownTimeout. It returns immediately if the server fails
+// to start listening, e.g. due to port conflicts.
+func (srv *WebhookServer) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", srv.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	srv.logger.Info("listening and serving", "addr", listener.Addr().String())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.httpServer.Serve(listener)
+	}()
+	atomic.StoreInt32(&srv.ready, 1)
+
+	select {
+	case err := <-serveErr:
+		atomic.StoreInt32(&srv.ready, 0)
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
 	}
 }
 
+// ListenAndServe serves webhook requests in background, logging failures.
+//
+// Deprecated: use Serve, that reports failures to start listening.
 func (srv *WebhookServer) ListenAndServe() {
-	log.Printf("[Webhook] Listening and serving on %s", srv.httpServer.Addr)
 	go func() {
-		if err := srv.httpServer.ListenAndServe(); err != nil {
-			log.Printf("[Webhook] ERR: %v", err)
+		if err := srv.Serve(context.Background()); err != nil {
+			srv.logger.Error(err, "failed to serve")
 		}
 	}()
 }
 
+// Ready tells whether the server listens and accepts webhook requests
+func (srv *WebhookServer) Ready() bool {
+	return atomic.LoadInt32(&srv.ready) == 1
+}
+
+// Shutdown stops accepting webhook requests and waits for in-flight callbacks
+// to finish. Callbacks still running once ctx is done get their context cancelled.
 func (srv *WebhookServer) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&srv.ready, 0)
+	defer srv.cancelCallbacks()
 	return srv.httpServer.Shutdown(ctx)
 }
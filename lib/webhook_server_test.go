@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+func TestWebhookServer_Serve(t *testing.T) {
+	cfg := DefaultWebhookServerConfig()
+	cfg.Addr = "127.0.0.1:0"
+
+	// Port conflicts are reported right away
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	conflictingCfg := DefaultWebhookServerConfig()
+	conflictingCfg.Addr = listener.Addr().String()
+	assert.Error(t, NewWebhookServer(func(context.Context, v1alpha1.MetricReport) {}, conflictingCfg).Serve(context.TODO()))
+
+	// Serves until cancelled, waiting for in-flight callbacks
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	cfg.Addr = listener.Addr().String()
+	listener.Close()
+	srv := NewWebhookServer(func(ctx context.Context, report v1alpha1.MetricReport) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	}, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(ctx)
+	}()
+
+	baseUrl := "http://" + cfg.Addr
+	assert.Eventually(t, func() bool {
+		res, err := http.Get(baseUrl + cfg.ReadinessPath)
+		if err != nil {
+			return false
+		}
+		defer res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	res, err := http.Get(baseUrl + cfg.HealthPath)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	go func() {
+		res, err := http.Post(baseUrl+cfg.WebhookPath, "application/json", strings.NewReader("[]"))
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	assert.NoError(t, <-served)
+	assert.False(t, srv.Ready())
+	select {
+	case <-finished:
+	default:
+		t.Fatal("server has not waited for in-flight callback")
+	}
+}
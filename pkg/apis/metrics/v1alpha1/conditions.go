@@ -0,0 +1,52 @@
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetCondition adds or updates the condition of the same type, keeping
+// its lastTransitionTime unless the status changes
+func (s *MetricWebhookStatus) SetCondition(condition MetricWebhookCondition) {
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	for i, existing := range s.Conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		s.Conditions[i] = condition
+		return
+	}
+	s.Conditions = append(s.Conditions, condition)
+}
+
+// RemoveCondition removes the condition of the type, if set
+func (s *MetricWebhookStatus) RemoveCondition(conditionType MetricWebhookConditionType) {
+	var conditions []MetricWebhookCondition
+	for _, condition := range s.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	s.Conditions = conditions
+}
+
+// GetCondition returns the condition of the type, nil if not set
+func (s *MetricWebhookStatus) GetCondition(conditionType MetricWebhookConditionType) *MetricWebhookCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue tells whether the condition of the type is set and true
+func (s *MetricWebhookStatus) IsConditionTrue(conditionType MetricWebhookConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == v1.ConditionTrue
+}
@@ -0,0 +1,88 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMetricWebhookStatus_SetCondition(t *testing.T) {
+	transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	existing := MetricWebhookCondition{
+		Type:               ReadyCondition,
+		Status:             v1.ConditionTrue,
+		LastTransitionTime: transition,
+		Reason:             "Reconciled",
+	}
+
+	tests := []struct {
+		name           string
+		condition      MetricWebhookCondition
+		keepTransition bool
+	}{
+		{
+			name:           "same status",
+			condition:      MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionTrue, Reason: "Reconciled"},
+			keepTransition: true,
+		},
+		{
+			name: "same status, other reason and message",
+			condition: MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionTrue, Reason: "Other",
+				Message: "updated", ObservedGeneration: 2},
+			keepTransition: true,
+		},
+		{
+			name: "same status, transition time set",
+			condition: MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionTrue, Reason: "Reconciled",
+				LastTransitionTime: metav1.Now()},
+			keepTransition: true,
+		},
+		{
+			name:      "status changed",
+			condition: MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionFalse, Reason: "FetchFailed"},
+		},
+		{
+			name:      "status unknown",
+			condition: MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionUnknown, Reason: "Reconciled"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := MetricWebhookStatus{Conditions: []MetricWebhookCondition{
+				existing,
+				{Type: AlertingCondition, Status: v1.ConditionFalse, LastTransitionTime: transition},
+			}}
+			status.SetCondition(test.condition)
+
+			assert.Len(t, status.Conditions, 2)
+			condition := status.GetCondition(ReadyCondition)
+			assert.Equal(t, test.condition.Status, condition.Status)
+			assert.Equal(t, test.condition.Reason, condition.Reason)
+			assert.Equal(t, test.condition.Message, condition.Message)
+			assert.Equal(t, test.condition.ObservedGeneration, condition.ObservedGeneration)
+			if test.keepTransition {
+				assert.Equal(t, transition, condition.LastTransitionTime)
+			} else {
+				assert.True(t, condition.LastTransitionTime.After(transition.Time))
+			}
+			// Other conditions are left as they are
+			assert.Equal(t, transition, status.GetCondition(AlertingCondition).LastTransitionTime)
+		})
+	}
+}
+
+func TestMetricWebhookStatus_SetConditionAppends(t *testing.T) {
+	var status MetricWebhookStatus
+	status.SetCondition(MetricWebhookCondition{Type: ReadyCondition, Status: v1.ConditionTrue})
+
+	assert.Len(t, status.Conditions, 1)
+	assert.False(t, status.Conditions[0].LastTransitionTime.IsZero())
+	assert.True(t, status.IsConditionTrue(ReadyCondition))
+
+	status.RemoveCondition(ReadyCondition)
+	assert.Nil(t, status.GetCondition(ReadyCondition))
+	assert.False(t, status.IsConditionTrue(ReadyCondition))
+}
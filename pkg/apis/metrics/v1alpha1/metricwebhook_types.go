@@ -21,13 +21,79 @@ type MetricWebhookSpec struct {
 	// used to trigger webhook
 	// +listType=set
 	Metrics []MetricSpec `json:"metrics"`
-	// scrapeInterval defines how frequently to scrape metrics
+	// scrapeInterval defines how frequently to scrape metrics, defaults to 30s
+	// +optional
 	ScrapeInterval metav1.Duration `json:"scrapeInterval"`
 	// Determines whether a metric alert sent one more time after values go
 	// under thresholds so that the client can track its adjustments improvements
+	// +optional
 	CooldownAlert bool `json:"cooldownAlert"`
+	// aggregation defines how the metric values of the pods matching the selector
+	// are aggregated before being compared to the targets, defaults to Average
+	// +optional
+	Aggregation MetricAggregation `json:"aggregation,omitempty"`
+	// failurePolicy defines how metrics failing to be fetched are reported,
+	// defaults to Ignore
+	// +optional
+	FailurePolicy MetricFailurePolicy `json:"failurePolicy,omitempty"`
+	// staleAfter defines how long a metric may fail to be fetched or keep
+	// the same sample before NoData or Stale notifications are sent, defaults to 5m
+	// +optional
+	StaleAfter metav1.Duration `json:"staleAfter,omitempty"`
+	// mode defines whether metric reports are delivered, only recorded in the
+	// status or metrics are not scraped at all, defaults to Active
+	// +optional
+	Mode MetricWebhookMode `json:"mode,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// +kubebuilder:validation:Enum=Active;DryRun;Suspended
+// MetricWebhookMode indicates whether metrics are scraped and reports delivered
+type MetricWebhookMode string
+
+const (
+	// ActiveMode scrapes metrics and delivers metric reports to the webhook
+	ActiveMode MetricWebhookMode = "Active"
+	// DryRunMode scrapes metrics, updates the status and posts events as
+	// ActiveMode does, but records the metric reports in the status instead
+	// of delivering them
+	DryRunMode MetricWebhookMode = "DryRun"
+	// SuspendedMode stops scraping metrics
+	SuspendedMode MetricWebhookMode = "Suspended"
+)
+
+// IsActive tells whether metric reports are delivered in the mode, unset meaning Active
+func (m MetricWebhookMode) IsActive() bool {
+	return m == "" || m == ActiveMode
 }
 
+// +k8s:openapi-gen=true
+// +kubebuilder:validation:Enum=Average
+// MetricAggregation indicates how metric values of several pods are aggregated
+type MetricAggregation string
+
+const (
+	// AverageAggregation averages metric values across the pods
+	AverageAggregation MetricAggregation = "Average"
+)
+
+// +k8s:openapi-gen=true
+// +kubebuilder:validation:Enum=Ignore;NoData;KeepLast
+// MetricFailurePolicy indicates how metrics failing to be fetched are reported
+type MetricFailurePolicy string
+
+const (
+	// IgnoreFailurePolicy reports neither alerts nor cooldowns for failing metrics
+	// until they have been failing for longer than staleAfter
+	IgnoreFailurePolicy MetricFailurePolicy = "Ignore"
+	// NoDataFailurePolicy reports NoData notifications for failing metrics
+	NoDataFailurePolicy MetricFailurePolicy = "NoData"
+	// KeepLastFailurePolicy reports failing metrics as if their last fetched
+	// values still hold, so that alerting metrics keep alerting until they have
+	// been failing for longer than staleAfter
+	KeepLastFailurePolicy MetricFailurePolicy = "KeepLast"
+)
+
 // Webhook describes the web endpoint that the operator calls on metrics reaching their thresholds
 // +k8s:openapi-gen=true
 type Webhook struct {
@@ -41,10 +107,12 @@ type Webhook struct {
 	// triggers all matching pods
 	// +optional
 	Service string `json:"service"`
-	// Service port the webserver serves on
+	// Service port the webserver serves on, defaults to 4030
+	// unless Url is specified
 	// +optional
 	Port int32 `json:"port"`
-	// URL path to the webhook
+	// URL path to the webhook, defaults to /metrics-webhook
+	// unless Url is specified
 	// +optional
 	Path string `json:"path"`
 }
@@ -83,6 +151,17 @@ type MetricSpec struct {
 	Resource *ResourceMetricSource `json:"resource,omitempty"`
 }
 
+// MetricName is the name of the metric, empty if the spec is invalid
+func (m *MetricSpec) MetricName() string {
+	switch {
+	case m.Type == PodsMetricSourceType && m.Pods != nil:
+		return m.Pods.Name
+	case m.Type == ResourceMetricSourceType && m.Resource != nil:
+		return m.Resource.Name.String()
+	}
+	return ""
+}
+
 // PodsMetricSource indicates when to call webhook on a metric describing each pod
 // matching the selector (for example, transactions-processed-per-second).
 // The values will be averaged together before being compared to the target value.
@@ -122,6 +201,74 @@ type MetricWebhookStatus struct {
 	// +listType=set
 	// +optional
 	Metrics []MetricStatus `json:"metrics"`
+	// conditions are the latest observations of the MetricWebhook state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []MetricWebhookCondition `json:"conditions,omitempty"`
+	// dryRunReports are the latest metric reports that would have been
+	// delivered in DryRun mode, oldest first
+	// +optional
+	DryRunReports []DryRunReport `json:"dryRunReports,omitempty"`
+	// mode is the mode the status has been last reported in, telling whether
+	// the alerts in the status have been delivered
+	// +optional
+	Mode MetricWebhookMode `json:"mode,omitempty"`
+}
+
+// DryRunReport is a metric report recorded rather than delivered in DryRun mode
+// +k8s:openapi-gen=true
+type DryRunReport struct {
+	// time is when the report would have been delivered
+	Time metav1.Time `json:"time"`
+	// urls are the resolved webhook endpoints the report would have been POSTed to
+	// +optional
+	Urls []string `json:"urls,omitempty"`
+	// payload is the JSON request body that would have been POSTed
+	Payload string `json:"payload"`
+	// error tells why webhook endpoints could not be resolved, if so
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// +k8s:openapi-gen=true
+// MetricWebhookConditionType is a type of MetricWebhook condition
+type MetricWebhookConditionType string
+
+const (
+	// ReadyCondition tells whether the spec is valid, metrics are available,
+	// webhook targets are resolved and reports are delivered to them
+	ReadyCondition MetricWebhookConditionType = "Ready"
+	// MetricsAvailableCondition tells whether the last scrape of metrics succeeded
+	MetricsAvailableCondition MetricWebhookConditionType = "MetricsAvailable"
+	// TargetsResolvedCondition tells whether the webhook endpoints have been resolved
+	TargetsResolvedCondition MetricWebhookConditionType = "TargetsResolved"
+	// WebhookDeliveringCondition tells whether the last metric report has been
+	// delivered to all of the webhook endpoints
+	WebhookDeliveringCondition MetricWebhookConditionType = "WebhookDelivering"
+	// AlertingCondition tells whether any of the metrics exceeds its target
+	AlertingCondition MetricWebhookConditionType = "Alerting"
+)
+
+// MetricWebhookCondition describes the state of a MetricWebhook at a certain point
+// +k8s:openapi-gen=true
+type MetricWebhookCondition struct {
+	// type of the condition
+	Type MetricWebhookConditionType `json:"type"`
+	// status of the condition, one of True, False, Unknown
+	Status v1.ConditionStatus `json:"status"`
+	// observedGeneration is the generation of the spec the condition has been set for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// lastTransitionTime is the last time the condition changed its status
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// reason is a CamelCase reason of the last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// message is a human readable description of the last transition
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // MetricStatus describes the last-read state of a single metric.
@@ -146,6 +293,24 @@ type MetricStatus struct {
 	Resource *ResourceMetricStatus `json:"resource,omitempty"`
 	// scrapeTime is the last time the MetricWebhook scraped metrics
 	ScrapeTime metav1.Time `json:"scrapeTime"`
+	// lastSuccessfulScrape is the last time the metric has been fetched successfully
+	// +optional
+	LastSuccessfulScrape *metav1.Time `json:"lastSuccessfulScrape,omitempty"`
+	// error is the reason the metric failed to be fetched on the last scrape,
+	// the values are the last fetched ones then, if any
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// MetricName is the name of the metric the status is of
+func (m *MetricStatus) MetricName() string {
+	switch {
+	case m.Pods != nil:
+		return m.Pods.Name
+	case m.Resource != nil:
+		return m.Resource.Name.String()
+	}
+	return ""
 }
 
 // PodsMetricStatus indicates the current value of a metric describing each pod
@@ -198,6 +363,10 @@ type ResourceMetricStatus struct {
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=metricwebhooks,scope=Namespaced
+// +kubebuilder:printcolumn:name="Mode",type="string",JSONPath=".spec.mode"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Alerting",type="string",JSONPath=".status.conditions[?(@.type==\"Alerting\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type MetricWebhook struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -220,6 +389,13 @@ type MetricWebhookList struct {
 // +kubebuilder:skipversion
 type MetricNotificationType string
 
+// NoData and Stale notifications describe a state rather than a change: the
+// operator repeats them in the report of every scrape for as long as the metric
+// is blind. lib.StatusWatcher synthesizes reports from the MetricWebhook status
+// instead, so it repeats them only when the status is updated or resynced, and
+// with the NoData failure policy only once the metric starts failing. Receivers
+// should keep their fallback until the metric is reported with data again
+// rather than rely on the cadence of these notifications.
 const (
 	// Alert metric notification informs about a metric those
 	// values exceeded the ones set by its thresholds.
@@ -229,8 +405,27 @@ const (
 	// notification may be used by the target application in order
 	// to correlate internal adjustments with metric values improvements.
 	Cooldown MetricNotificationType = "Cooldown"
+	// NoData metric notification informs about a metric that has been
+	// failing to be fetched for longer than staleAfter, or failed once with
+	// the NoData failure policy. Its values are the last fetched ones, if any,
+	// and should not be relied upon.
+	NoData MetricNotificationType = "NoData"
+	// Stale metric notification informs about a metric that has been fetched
+	// with the same sample for longer than staleAfter, e.g. since the metrics
+	// pipeline stalled. Its values should not be relied upon.
+	Stale MetricNotificationType = "Stale"
+	// Withdrawn metric notification informs about an alerting metric that
+	// is not monitored anymore, since either the metric has been removed from
+	// the MetricWebhook or the MetricWebhook has been deleted. No further
+	// notifications are sent about the metric, so the target application
+	// should not wait for a Cooldown to leave the degraded mode.
+	Withdrawn MetricNotificationType = "Withdrawn"
 )
 
+// WithdrawFinalizer makes sure alerting metrics are withdrawn before
+// the MetricWebhook is deleted
+const WithdrawFinalizer = "metrics.wingsofovnia.github.com/withdraw"
+
 // +k8s:deepcopy-gen=false
 // +k8s:openapi-gen=false
 // +kubebuilder:skipversion
@@ -245,14 +440,60 @@ type MetricNotification struct {
 	ScrapeTime                time.Time              `json:"scrapeTime"`
 }
 
+// NewMetricNotification creates a notification of the given type about the metric status
+func NewMetricNotification(typ MetricNotificationType, metric MetricStatus) MetricNotification {
+	switch metric.Type {
+	case PodsMetricSourceType:
+		return MetricNotification{
+			Type: typ,
+
+			MetricType: metric.Type,
+			Name:       metric.Pods.Name,
+
+			CurrentAverageValue: metric.Pods.CurrentAverageValue,
+			TargetAverageValue:  &metric.Pods.TargetAverageValue,
+
+			ScrapeTime: metric.ScrapeTime.Time,
+		}
+	case ResourceMetricSourceType:
+		return MetricNotification{
+			Type: typ,
+
+			MetricType: metric.Type,
+			Name:       metric.Resource.Name.String(),
+
+			CurrentAverageValue: metric.Resource.CurrentAverageValue,
+			TargetAverageValue:  metric.Resource.TargetAverageValue,
+
+			CurrentAverageUtilization: metric.Resource.CurrentAverageUtilization,
+			TargetAverageUtilization:  metric.Resource.TargetAverageUtilization,
+
+			ScrapeTime: metric.ScrapeTime.Time,
+		}
+	}
+	return MetricNotification{}
+}
+
+// HasData tells whether the notification carries current metric values
+func (n *MetricNotification) HasData() bool {
+	return n.Type == Alert || n.Type == Cooldown
+}
+
+// IsBlind tells whether the metric is monitored but its current values are unknown
+func (n *MetricNotification) IsBlind() bool {
+	return n.Type == NoData || n.Type == Stale
+}
+
 func (n *MetricNotification) String() string {
 	var tokens []string
 
 	tokens = append(tokens, fmt.Sprintf("name = %s", n.Name))
-	if n.TargetAverageUtilization != nil {
+	if n.TargetAverageUtilization != nil && n.CurrentAverageUtilization != nil {
 		tokens = append(tokens, fmt.Sprintf("avg utilization = %d%%/%d%%", *n.CurrentAverageUtilization, *n.TargetAverageUtilization))
-	} else {
+	} else if n.TargetAverageValue != nil {
 		tokens = append(tokens, fmt.Sprintf("avg value = %s/%s", n.CurrentAverageValue.String(), n.TargetAverageValue.String()))
+	} else {
+		tokens = append(tokens, fmt.Sprintf("avg value = %s", n.CurrentAverageValue.String()))
 	}
 
 	return string(n.Type) + "[" + strings.Join(tokens, ", ") + "]"
@@ -272,6 +513,27 @@ func (r *MetricReport) HasAlerts() bool {
 	return false
 }
 
+// HasMissingData tells whether any of the metrics is reported without current
+// values, so that the receiver may fall back to a safe configuration
+func (r *MetricReport) HasMissingData() bool {
+	for _, n := range *r {
+		if n.IsBlind() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWithdrawn tells whether the report withdraws metrics only
+func (r *MetricReport) IsWithdrawn() bool {
+	for _, n := range *r {
+		if n.Type != Withdrawn {
+			return false
+		}
+	}
+	return len(*r) > 0
+}
+
 func (r *MetricReport) String() string {
 	var tokens []string
 	for _, notification := range *r {
@@ -280,6 +542,17 @@ func (r *MetricReport) String() string {
 	return strings.Join(tokens, ", ")
 }
 
+// +k8s:deepcopy-gen=false
+// +k8s:openapi-gen=false
+// +kubebuilder:skipversion
+// MetricReportEvent is a metric report streamed to subscribers of a MetricWebhook
+type MetricReportEvent struct {
+	// Namespace and Name identify the MetricWebhook the report is sent by
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	Report    MetricReport `json:"report"`
+}
+
 func init() {
 	SchemeBuilder.Register(&MetricWebhook{}, &MetricWebhookList{})
 }
@@ -0,0 +1,194 @@
+package v1alpha1
+
+import (
+	"net/url"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// DefaultScrapeInterval is how frequently metrics are scraped unless specified
+	DefaultScrapeInterval = 30 * time.Second
+	// DefaultWebhookPort and DefaultWebhookPath are the ones the lib webhook
+	// server serves on by default
+	DefaultWebhookPort int32 = 4030
+	DefaultWebhookPath       = "/metrics-webhook"
+	// DefaultStaleAfter is how long metrics may fail or keep the same sample
+	// before NoData or Stale notifications are sent unless specified
+	DefaultStaleAfter = 5 * time.Minute
+)
+
+// Default sets the defaults of the fields left unspecified, implementing
+// admission.Defaulter. CooldownAlert has no default, cooldowns are opt-in.
+func (r *MetricWebhook) Default() {
+	if r.Spec.ScrapeInterval.Duration == 0 {
+		r.Spec.ScrapeInterval.Duration = DefaultScrapeInterval
+	}
+	if r.Spec.Aggregation == "" {
+		r.Spec.Aggregation = AverageAggregation
+	}
+	if r.Spec.StaleAfter.Duration == 0 {
+		r.Spec.StaleAfter.Duration = DefaultStaleAfter
+	}
+	if r.Spec.FailurePolicy == "" {
+		r.Spec.FailurePolicy = IgnoreFailurePolicy
+	}
+	if r.Spec.Mode == "" {
+		r.Spec.Mode = ActiveMode
+	}
+	if r.Spec.Webhook.Url == "" {
+		if r.Spec.Webhook.Port == 0 {
+			r.Spec.Webhook.Port = DefaultWebhookPort
+		}
+		if r.Spec.Webhook.Path == "" {
+			r.Spec.Webhook.Path = DefaultWebhookPath
+		}
+	}
+}
+
+// Validate checks the spec for values the operator cannot reconcile,
+// the defaults are expected to be set already, see Default
+func (r *MetricWebhook) Validate() field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, metav1validation.ValidateLabelSelector(&r.Spec.Selector, specPath.Child("selector"))...)
+	errs = append(errs, validateWebhook(r.Spec.Webhook, specPath.Child("webhook"))...)
+
+	metricsPath := specPath.Child("metrics")
+	if len(r.Spec.Metrics) == 0 {
+		errs = append(errs, field.Required(metricsPath, "at least one metric must be specified"))
+	}
+	names := make(map[string]bool)
+	for i, metric := range r.Spec.Metrics {
+		metricPath := metricsPath.Index(i)
+		errs = append(errs, validateMetricSpec(metric, metricPath)...)
+
+		if name := metric.MetricName(); name != "" {
+			if names[name] {
+				errs = append(errs, field.Duplicate(metricPath, name))
+			}
+			names[name] = true
+		}
+	}
+
+	if r.Spec.Aggregation != AverageAggregation {
+		errs = append(errs, field.NotSupported(specPath.Child("aggregation"), r.Spec.Aggregation,
+			[]string{string(AverageAggregation)}))
+	}
+
+	switch r.Spec.FailurePolicy {
+	case IgnoreFailurePolicy, NoDataFailurePolicy, KeepLastFailurePolicy:
+	default:
+		errs = append(errs, field.NotSupported(specPath.Child("failurePolicy"), r.Spec.FailurePolicy,
+			[]string{string(IgnoreFailurePolicy), string(NoDataFailurePolicy), string(KeepLastFailurePolicy)}))
+	}
+
+	switch r.Spec.Mode {
+	case ActiveMode, DryRunMode, SuspendedMode:
+	default:
+		errs = append(errs, field.NotSupported(specPath.Child("mode"), r.Spec.Mode,
+			[]string{string(ActiveMode), string(DryRunMode), string(SuspendedMode)}))
+	}
+
+	if r.Spec.ScrapeInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("scrapeInterval"), r.Spec.ScrapeInterval.Duration.String(),
+			"must be positive"))
+	}
+
+	if r.Spec.StaleAfter.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("staleAfter"), r.Spec.StaleAfter.Duration.String(),
+			"must be positive"))
+	}
+
+	return errs
+}
+
+func validateWebhook(webhook Webhook, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if webhook.Url != "" && webhook.Service != "" {
+		errs = append(errs, field.Forbidden(path.Child("service"), "may not be set together with url"))
+	}
+	if webhook.Url != "" {
+		if parsedUrl, err := url.Parse(webhook.Url); err != nil || parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+			errs = append(errs, field.Invalid(path.Child("url"), webhook.Url, "must be an absolute URL"))
+		}
+	}
+	if webhook.Port < 0 || webhook.Port > 65535 {
+		errs = append(errs, field.Invalid(path.Child("port"), webhook.Port, "must be between 0 and 65535"))
+	}
+	return errs
+}
+
+func validateMetricSpec(metric MetricSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch metric.Type {
+	case PodsMetricSourceType:
+		podsPath := path.Child("pods")
+		if metric.Pods == nil {
+			errs = append(errs, field.Required(podsPath, "must be set for Pods metrics"))
+			break
+		}
+		if metric.Pods.Name == "" {
+			errs = append(errs, field.Required(podsPath.Child("name"), ""))
+		}
+		if metric.Pods.TargetAverageValue.Sign() <= 0 {
+			errs = append(errs, field.Invalid(podsPath.Child("targetAverageValue"), metric.Pods.TargetAverageValue.String(),
+				"must be positive"))
+		}
+	case ResourceMetricSourceType:
+		resourcePath := path.Child("resource")
+		if metric.Resource == nil {
+			errs = append(errs, field.Required(resourcePath, "must be set for Resource metrics"))
+			break
+		}
+		if metric.Resource.Name == "" {
+			errs = append(errs, field.Required(resourcePath.Child("name"), ""))
+		}
+		switch {
+		case metric.Resource.TargetAverageUtilization == nil && metric.Resource.TargetAverageValue == nil:
+			errs = append(errs, field.Required(resourcePath,
+				"either targetAverageUtilization or targetAverageValue must be set"))
+		case metric.Resource.TargetAverageUtilization != nil && *metric.Resource.TargetAverageUtilization <= 0:
+			errs = append(errs, field.Invalid(resourcePath.Child("targetAverageUtilization"),
+				*metric.Resource.TargetAverageUtilization, "must be positive"))
+		case metric.Resource.TargetAverageValue != nil && metric.Resource.TargetAverageValue.Sign() <= 0:
+			errs = append(errs, field.Invalid(resourcePath.Child("targetAverageValue"),
+				metric.Resource.TargetAverageValue.String(), "must be positive"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), metric.Type,
+			[]string{string(PodsMetricSourceType), string(ResourceMetricSourceType)}))
+	}
+	return errs
+}
+
+func (r *MetricWebhook) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("MetricWebhook").GroupKind(), r.Name, errs)
+}
+
+// ValidateCreate implements admission.Validator
+func (r *MetricWebhook) ValidateCreate() error {
+	return r.invalid(r.Validate())
+}
+
+// ValidateUpdate implements admission.Validator
+func (r *MetricWebhook) ValidateUpdate(old runtime.Object) error {
+	if r.DeletionTimestamp != nil {
+		// Let objects created invalid before the webhook was installed be finalized
+		return nil
+	}
+	return r.invalid(r.Validate())
+}
+
+// ValidateDelete implements admission.Validator
+func (r *MetricWebhook) ValidateDelete() error {
+	return nil
+}
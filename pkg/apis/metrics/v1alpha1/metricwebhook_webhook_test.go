@@ -0,0 +1,194 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validMetricWebhook is a defaulted MetricWebhook passing validation
+func validMetricWebhook() *MetricWebhook {
+	utilization := int32(50)
+	metricWebhook := &MetricWebhook{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: MetricWebhookSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+			Metrics: []MetricSpec{
+				{
+					Type: ResourceMetricSourceType,
+					Resource: &ResourceMetricSource{
+						Name:                     v1.ResourceCPU,
+						TargetAverageUtilization: &utilization,
+					},
+				},
+				{
+					Type: PodsMetricSourceType,
+					Pods: &PodsMetricSource{
+						Name:               "requests_per_second",
+						TargetAverageValue: resource.MustParse("100"),
+					},
+				},
+			},
+		},
+	}
+	metricWebhook.Default()
+	return metricWebhook
+}
+
+func TestMetricWebhook_Default(t *testing.T) {
+	metricWebhook := &MetricWebhook{}
+	metricWebhook.Default()
+
+	assert.Equal(t, DefaultScrapeInterval, metricWebhook.Spec.ScrapeInterval.Duration)
+	assert.Equal(t, AverageAggregation, metricWebhook.Spec.Aggregation)
+	assert.Equal(t, DefaultStaleAfter, metricWebhook.Spec.StaleAfter.Duration)
+	assert.Equal(t, IgnoreFailurePolicy, metricWebhook.Spec.FailurePolicy)
+	assert.Equal(t, ActiveMode, metricWebhook.Spec.Mode)
+	assert.Equal(t, DefaultWebhookPort, metricWebhook.Spec.Webhook.Port)
+	assert.Equal(t, DefaultWebhookPath, metricWebhook.Spec.Webhook.Path)
+	assert.False(t, metricWebhook.Spec.CooldownAlert)
+
+	// Values set are kept
+	specified := validMetricWebhook()
+	specified.Spec.ScrapeInterval.Duration = time.Minute
+	specified.Spec.StaleAfter.Duration = time.Hour
+	specified.Spec.FailurePolicy = KeepLastFailurePolicy
+	specified.Spec.Mode = DryRunMode
+	specified.Spec.Webhook = Webhook{Service: "app", Port: 8080, Path: "/hook"}
+	defaulted := specified.DeepCopy()
+	defaulted.Default()
+	assert.Equal(t, specified, defaulted)
+}
+
+func TestMetricWebhook_DefaultWithUrl(t *testing.T) {
+	// The url is used as is, neither port nor path are defaulted
+	metricWebhook := &MetricWebhook{Spec: MetricWebhookSpec{
+		Webhook: Webhook{Url: "http://app.example.com"},
+	}}
+	metricWebhook.Default()
+
+	assert.Equal(t, Webhook{Url: "http://app.example.com"}, metricWebhook.Spec.Webhook)
+	assert.Empty(t, validateWebhook(metricWebhook.Spec.Webhook, field.NewPath("webhook")))
+}
+
+func TestMetricWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *MetricWebhook)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *MetricWebhook) {},
+		},
+		{
+			name: "pods metric without pods",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Metrics[1].Pods = nil
+			},
+			fields: []string{"spec.metrics[1].pods"},
+		},
+		{
+			name: "resource metric without targets",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Metrics[0].Resource.TargetAverageUtilization = nil
+			},
+			fields: []string{"spec.metrics[0].resource"},
+		},
+		{
+			name: "duplicate metric names",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Metrics = append(r.Spec.Metrics, *r.Spec.Metrics[0].DeepCopy())
+			},
+			fields: []string{"spec.metrics[2]"},
+		},
+		{
+			name: "no metrics",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Metrics = nil
+			},
+			fields: []string{"spec.metrics"},
+		},
+		{
+			name: "unknown metric type",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Metrics[0].Type = "External"
+			},
+			fields: []string{"spec.metrics[0].type"},
+		},
+		{
+			name: "url and service",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Webhook.Url = "http://app.default.svc:4030/metrics-webhook"
+				r.Spec.Webhook.Service = "app"
+			},
+			fields: []string{"spec.webhook.service"},
+		},
+		{
+			name: "relative url",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Webhook.Url = "/metrics-webhook"
+			},
+			fields: []string{"spec.webhook.url"},
+		},
+		{
+			name: "zero scrape interval",
+			modify: func(r *MetricWebhook) {
+				r.Spec.ScrapeInterval.Duration = 0
+			},
+			fields: []string{"spec.scrapeInterval"},
+		},
+		{
+			name: "negative scrape interval",
+			modify: func(r *MetricWebhook) {
+				r.Spec.ScrapeInterval.Duration = -time.Second
+			},
+			fields: []string{"spec.scrapeInterval"},
+		},
+		{
+			name: "zero stale after",
+			modify: func(r *MetricWebhook) {
+				r.Spec.StaleAfter.Duration = 0
+			},
+			fields: []string{"spec.staleAfter"},
+		},
+		{
+			name: "negative stale after",
+			modify: func(r *MetricWebhook) {
+				r.Spec.StaleAfter.Duration = -time.Minute
+			},
+			fields: []string{"spec.staleAfter"},
+		},
+		{
+			name: "unknown mode",
+			modify: func(r *MetricWebhook) {
+				r.Spec.Mode = "Paused"
+			},
+			fields: []string{"spec.mode"},
+		},
+		{
+			name: "unknown failure policy",
+			modify: func(r *MetricWebhook) {
+				r.Spec.FailurePolicy = "Fail"
+			},
+			fields: []string{"spec.failurePolicy"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metricWebhook := validMetricWebhook()
+			test.modify(metricWebhook)
+
+			var fields []string
+			for _, err := range metricWebhook.Validate() {
+				fields = append(fields, err.Field)
+			}
+			assert.Equal(t, test.fields, fields)
+		})
+	}
+}
@@ -8,6 +8,28 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DryRunReport) DeepCopyInto(out *DryRunReport) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Urls != nil {
+		in, out := &in.Urls, &out.Urls
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DryRunReport.
+func (in *DryRunReport) DeepCopy() *DryRunReport {
+	if in == nil {
+		return nil
+	}
+	out := new(DryRunReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricSpec) DeepCopyInto(out *MetricSpec) {
 	*out = *in
@@ -48,6 +70,10 @@ func (in *MetricStatus) DeepCopyInto(out *MetricStatus) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.ScrapeTime.DeepCopyInto(&out.ScrapeTime)
+	if in.LastSuccessfulScrape != nil {
+		in, out := &in.LastSuccessfulScrape, &out.LastSuccessfulScrape
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -89,6 +115,23 @@ func (in *MetricWebhook) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricWebhookCondition) DeepCopyInto(out *MetricWebhookCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricWebhookCondition.
+func (in *MetricWebhookCondition) DeepCopy() *MetricWebhookCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricWebhookCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricWebhookList) DeepCopyInto(out *MetricWebhookList) {
 	*out = *in
@@ -135,6 +178,7 @@ func (in *MetricWebhookSpec) DeepCopyInto(out *MetricWebhookSpec) {
 		}
 	}
 	out.ScrapeInterval = in.ScrapeInterval
+	out.StaleAfter = in.StaleAfter
 	return
 }
 
@@ -158,6 +202,20 @@ func (in *MetricWebhookStatus) DeepCopyInto(out *MetricWebhookStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]MetricWebhookCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DryRunReports != nil {
+		in, out := &in.DryRunReports, &out.DryRunReports
+		*out = make([]DryRunReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
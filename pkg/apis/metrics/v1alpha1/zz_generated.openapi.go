@@ -11,16 +11,68 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"./pkg/apis/metrics/v1alpha1.MetricSpec":           schema_pkg_apis_metrics_v1alpha1_MetricSpec(ref),
-		"./pkg/apis/metrics/v1alpha1.MetricStatus":         schema_pkg_apis_metrics_v1alpha1_MetricStatus(ref),
-		"./pkg/apis/metrics/v1alpha1.MetricWebhook":        schema_pkg_apis_metrics_v1alpha1_MetricWebhook(ref),
-		"./pkg/apis/metrics/v1alpha1.MetricWebhookSpec":    schema_pkg_apis_metrics_v1alpha1_MetricWebhookSpec(ref),
-		"./pkg/apis/metrics/v1alpha1.MetricWebhookStatus":  schema_pkg_apis_metrics_v1alpha1_MetricWebhookStatus(ref),
-		"./pkg/apis/metrics/v1alpha1.PodsMetricSource":     schema_pkg_apis_metrics_v1alpha1_PodsMetricSource(ref),
-		"./pkg/apis/metrics/v1alpha1.PodsMetricStatus":     schema_pkg_apis_metrics_v1alpha1_PodsMetricStatus(ref),
-		"./pkg/apis/metrics/v1alpha1.ResourceMetricSource": schema_pkg_apis_metrics_v1alpha1_ResourceMetricSource(ref),
-		"./pkg/apis/metrics/v1alpha1.ResourceMetricStatus": schema_pkg_apis_metrics_v1alpha1_ResourceMetricStatus(ref),
-		"./pkg/apis/metrics/v1alpha1.Webhook":              schema_pkg_apis_metrics_v1alpha1_Webhook(ref),
+		"./pkg/apis/metrics/v1alpha1.DryRunReport":           schema_pkg_apis_metrics_v1alpha1_DryRunReport(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricSpec":             schema_pkg_apis_metrics_v1alpha1_MetricSpec(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricStatus":           schema_pkg_apis_metrics_v1alpha1_MetricStatus(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricWebhook":          schema_pkg_apis_metrics_v1alpha1_MetricWebhook(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricWebhookCondition": schema_pkg_apis_metrics_v1alpha1_MetricWebhookCondition(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricWebhookSpec":      schema_pkg_apis_metrics_v1alpha1_MetricWebhookSpec(ref),
+		"./pkg/apis/metrics/v1alpha1.MetricWebhookStatus":    schema_pkg_apis_metrics_v1alpha1_MetricWebhookStatus(ref),
+		"./pkg/apis/metrics/v1alpha1.PodsMetricSource":       schema_pkg_apis_metrics_v1alpha1_PodsMetricSource(ref),
+		"./pkg/apis/metrics/v1alpha1.PodsMetricStatus":       schema_pkg_apis_metrics_v1alpha1_PodsMetricStatus(ref),
+		"./pkg/apis/metrics/v1alpha1.ResourceMetricSource":   schema_pkg_apis_metrics_v1alpha1_ResourceMetricSource(ref),
+		"./pkg/apis/metrics/v1alpha1.ResourceMetricStatus":   schema_pkg_apis_metrics_v1alpha1_ResourceMetricStatus(ref),
+		"./pkg/apis/metrics/v1alpha1.Webhook":                schema_pkg_apis_metrics_v1alpha1_Webhook(ref),
+	}
+}
+
+func schema_pkg_apis_metrics_v1alpha1_DryRunReport(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "DryRunReport is a metric report recorded rather than delivered in DryRun mode",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"time": {
+						SchemaProps: spec.SchemaProps{
+							Description: "time is when the report would have been delivered",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"urls": {
+						SchemaProps: spec.SchemaProps{
+							Description: "urls are the resolved webhook endpoints the report would have been POSTed to",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"payload": {
+						SchemaProps: spec.SchemaProps{
+							Description: "payload is the JSON request body that would have been POSTed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"error": {
+						SchemaProps: spec.SchemaProps{
+							Description: "error tells why webhook endpoints could not be resolved, if so",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"time", "payload"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
@@ -98,6 +150,19 @@ func schema_pkg_apis_metrics_v1alpha1_MetricStatus(ref common.ReferenceCallback)
 							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
 						},
 					},
+					"lastSuccessfulScrape": {
+						SchemaProps: spec.SchemaProps{
+							Description: "lastSuccessfulScrape is the last time the metric has been fetched successfully",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"error": {
+						SchemaProps: spec.SchemaProps{
+							Description: "error is the reason the metric failed to be fetched on the last scrape, the values are the last fetched ones then, if any",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"type", "alerting", "scrapeTime"},
 			},
@@ -151,6 +216,63 @@ func schema_pkg_apis_metrics_v1alpha1_MetricWebhook(ref common.ReferenceCallback
 	}
 }
 
+func schema_pkg_apis_metrics_v1alpha1_MetricWebhookCondition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "MetricWebhookCondition describes the state of a MetricWebhook at a certain point",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "type of the condition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "status of the condition, one of True, False, Unknown",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "observedGeneration is the generation of the spec the condition has been set for",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "lastTransitionTime is the last time the condition changed its status",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "reason is a CamelCase reason of the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "message is a human readable description of the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"type", "status"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
 func schema_pkg_apis_metrics_v1alpha1_MetricWebhookSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -190,7 +312,7 @@ func schema_pkg_apis_metrics_v1alpha1_MetricWebhookSpec(ref common.ReferenceCall
 					},
 					"scrapeInterval": {
 						SchemaProps: spec.SchemaProps{
-							Description: "scrapeInterval defines how frequently to scrape metrics",
+							Description: "scrapeInterval defines how frequently to scrape metrics, defaults to 30s",
 							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
 						},
 					},
@@ -201,8 +323,35 @@ func schema_pkg_apis_metrics_v1alpha1_MetricWebhookSpec(ref common.ReferenceCall
 							Format:      "",
 						},
 					},
+					"aggregation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "aggregation defines how the metric values of the pods matching the selector are aggregated before being compared to the targets, defaults to Average",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"failurePolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "failurePolicy defines how metrics failing to be fetched are reported, defaults to Ignore",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"staleAfter": {
+						SchemaProps: spec.SchemaProps{
+							Description: "staleAfter defines how long a metric may fail to be fetched or keep the same sample before NoData or Stale notifications are sent, defaults to 5m",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"mode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "mode defines whether metric reports are delivered, only recorded in the status or metrics are not scraped at all, defaults to Active",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
-				Required: []string{"selector", "webhook", "metrics", "scrapeInterval", "cooldownAlert"},
+				Required: []string{"selector", "webhook", "metrics"},
 			},
 		},
 		Dependencies: []string{
@@ -235,11 +384,50 @@ func schema_pkg_apis_metrics_v1alpha1_MetricWebhookStatus(ref common.ReferenceCa
 							},
 						},
 					},
+					"conditions": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-map-keys": "type",
+								"x-kubernetes-list-type":     "map",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "conditions are the latest observations of the MetricWebhook state",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/metrics/v1alpha1.MetricWebhookCondition"),
+									},
+								},
+							},
+						},
+					},
+					"dryRunReports": {
+						SchemaProps: spec.SchemaProps{
+							Description: "dryRunReports are the latest metric reports that would have been delivered in DryRun mode, oldest first",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/metrics/v1alpha1.DryRunReport"),
+									},
+								},
+							},
+						},
+					},
+					"mode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "mode is the mode the status has been last reported in, telling whether the alerts in the status have been delivered",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"./pkg/apis/metrics/v1alpha1.MetricStatus"},
+			"./pkg/apis/metrics/v1alpha1.DryRunReport", "./pkg/apis/metrics/v1alpha1.MetricStatus", "./pkg/apis/metrics/v1alpha1.MetricWebhookCondition"},
 	}
 }
 
@@ -415,14 +603,14 @@ func schema_pkg_apis_metrics_v1alpha1_Webhook(ref common.ReferenceCallback) comm
 					},
 					"port": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Service port the webserver serves on",
+							Description: "Service port the webserver serves on, defaults to 4030 unless Url is specified",
 							Type:        []string{"integer"},
 							Format:      "int32",
 						},
 					},
 					"path": {
 						SchemaProps: spec.SchemaProps{
-							Description: "URL path to the webhook",
+							Description: "URL path to the webhook, defaults to /metrics-webhook unless Url is specified",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -0,0 +1,156 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Flags binds command line flags to an OperatorConfig. The flags set
+// explicitly take precedence over the configuration file given with --config.
+type Flags struct {
+	configFile string
+	config     *OperatorConfig
+	fs         *pflag.FlagSet
+	names      map[string]bool
+}
+
+// NewFlags adds the --config flag and the flags overriding the configuration
+// file to fs, the flags default to DefaultOperatorConfig
+func NewFlags(fs *pflag.FlagSet) *Flags {
+	cfg := DefaultOperatorConfig()
+	f := &Flags{config: cfg, fs: fs, names: make(map[string]bool)}
+
+	fs.StringVar(&f.configFile, "config", "", "The operator configuration file, see deploy/operator_config.yaml")
+
+	own := pflag.NewFlagSet("operator", pflag.ContinueOnError)
+	own.Var((*namespacesValue)(&cfg.WatchNamespaces), "watch-namespaces",
+		"Comma-separated namespaces to reconcile MetricWebhooks in, empty for all namespaces (default $WATCH_NAMESPACE)")
+	own.StringVar(&cfg.Metrics.Host, "metrics-host", cfg.Metrics.Host, "The host the metrics endpoints bind to")
+	own.Int32Var(&cfg.Metrics.Port, "metrics-port", cfg.Metrics.Port, "The port operator metrics are served on")
+	own.Int32Var(&cfg.Metrics.CRMetricsPort, "cr-metrics-port", cfg.Metrics.CRMetricsPort,
+		"The port custom resource metrics are served on")
+	own.IntVar(&cfg.Webhook.Port, "webhook-port", cfg.Webhook.Port, "The port the admission webhook server binds to")
+	own.StringVar(&cfg.Stream.BindAddress, "stream-bind-address", cfg.Stream.BindAddress,
+		"The address metric reports are streamed on")
+	own.DurationVar(&cfg.Delivery.Timeout.Duration, "delivery-timeout", cfg.Delivery.Timeout.Duration,
+		"The timeout of a single metric report delivery to a webhook")
+	own.IntVar(&cfg.Delivery.Retries, "delivery-retries", cfg.Delivery.Retries,
+		"How many times a retryable delivery failure is retried")
+	own.DurationVar(&cfg.Delivery.RetryBackoff.Duration, "delivery-retry-backoff", cfg.Delivery.RetryBackoff.Duration,
+		"The delay before the first delivery retry, doubled on each next one")
+	own.IntVar(&cfg.MaxConcurrentReconciles, "max-concurrent-reconciles", cfg.MaxConcurrentReconciles,
+		"The number of MetricWebhooks reconciled at once")
+	own.BoolVar(&cfg.LeaderElection.LeaderElect, "leader-elect", cfg.LeaderElection.LeaderElect,
+		"Elect a leader before starting, disable only if running a single replica")
+	own.StringVar((*string)(&cfg.LeaderElection.Mode), "leader-election-mode", string(cfg.LeaderElection.Mode),
+		"The leader election mode, either LeaderForLife or Lease")
+	own.StringVar(&cfg.LeaderElection.LockName, "leader-election-lock-name", cfg.LeaderElection.LockName,
+		"The name of the leader election lock ConfigMap")
+	own.StringVar(&cfg.LeaderElection.Namespace, "leader-election-namespace", cfg.LeaderElection.Namespace,
+		"The namespace of the leader election lock in Lease mode (default the operator namespace)")
+	own.DurationVar(&cfg.LeaderElection.LeaseDuration.Duration, "leader-election-lease-duration",
+		cfg.LeaderElection.LeaseDuration.Duration, "How long non-leaders wait before taking over the lease")
+	own.DurationVar(&cfg.LeaderElection.RenewDeadline.Duration, "leader-election-renew-deadline",
+		cfg.LeaderElection.RenewDeadline.Duration, "How long the leader retries renewing the lease")
+	own.DurationVar(&cfg.LeaderElection.RetryPeriod.Duration, "leader-election-retry-period",
+		cfg.LeaderElection.RetryPeriod.Duration, "The delay between attempts to acquire or renew the lease")
+	own.Var((*featureGatesValue)(&cfg.FeatureGates), "feature-gates",
+		fmt.Sprintf("Comma-separated Feature=true|false pairs, known features: %s", strings.Join(knownFeatures(), ", ")))
+
+	own.VisitAll(func(flag *pflag.Flag) {
+		f.names[flag.Name] = true
+	})
+	fs.AddFlagSet(own)
+	return f
+}
+
+// Complete loads the configuration file, if any, overrides it with the flags
+// set and validates the result. It is called once fs has been parsed.
+func (f *Flags) Complete() (*OperatorConfig, error) {
+	if f.configFile != "" {
+		// Loading the file overwrites the flag values bound, set them again afterwards
+		changed := make(map[string]string)
+		f.fs.Visit(func(flag *pflag.Flag) {
+			if f.names[flag.Name] {
+				changed[flag.Name] = flag.Value.String()
+			}
+		})
+		if err := f.config.LoadFile(f.configFile); err != nil {
+			return nil, err
+		}
+		for name, value := range changed {
+			if err := f.fs.Set(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if errs := f.config.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid operator config: %v", errs.ToAggregate())
+	}
+	return f.config, nil
+}
+
+// namespacesValue is a comma-separated list of namespaces,
+// an empty value meaning all namespaces
+type namespacesValue []string
+
+func (v *namespacesValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *namespacesValue) Set(value string) error {
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		namespaces = append(namespaces, strings.TrimSpace(namespace))
+	}
+	*v = namespaces
+	return nil
+}
+
+func (v *namespacesValue) Type() string {
+	return "strings"
+}
+
+// featureGatesValue is a comma-separated list of Feature=true|false pairs,
+// merged into the feature gates already set
+type featureGatesValue map[Feature]bool
+
+func (v *featureGatesValue) String() string {
+	var pairs []string
+	for feature, enabled := range *v {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", feature, enabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *featureGatesValue) Set(value string) error {
+	if *v == nil {
+		*v = make(map[Feature]bool)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 {
+			return fmt.Errorf("missing value of feature gate %s", pair)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(keyValue[1]))
+		if err != nil {
+			return fmt.Errorf("invalid value of feature gate %s: %v", pair, err)
+		}
+		(*v)[Feature(strings.TrimSpace(keyValue[0]))] = enabled
+	}
+	return nil
+}
+
+func (v *featureGatesValue) Type() string {
+	return "mapStringBool"
+}
@@ -0,0 +1,151 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `apiVersion: config.metrics.wingsofovnia.github.com/v1alpha1
+kind: OperatorConfig
+watchNamespaces: [default]
+metrics:
+  port: 9090
+delivery:
+  retries: 5
+  retryBackoff: 1s
+featureGates:
+  ReportStream: false
+  TargetWatches: false
+`
+
+// writeConfig writes the configuration file to a temporary directory
+// removed by the cleanup returned
+func writeConfig(t *testing.T, content string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "operator-config")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func completeFlags(args ...string) (*OperatorConfig, error) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags := NewFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return flags.Complete()
+}
+
+func TestFlags_Defaults(t *testing.T) {
+	cfg, err := completeFlags()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOperatorConfig(), cfg)
+}
+
+func TestFlags_FileOnly(t *testing.T) {
+	path, cleanup := writeConfig(t, testConfig)
+	defer cleanup()
+	cfg, err := completeFlags("--config", path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"default"}, cfg.WatchNamespaces)
+	assert.Equal(t, int32(9090), cfg.Metrics.Port)
+	assert.Equal(t, 5, cfg.Delivery.Retries)
+	assert.Equal(t, time.Second, cfg.Delivery.RetryBackoff.Duration)
+	assert.False(t, cfg.Enabled(ReportStream))
+
+	// Values not set in the file are defaulted
+	defaults := DefaultOperatorConfig()
+	assert.Equal(t, defaults.Metrics.CRMetricsPort, cfg.Metrics.CRMetricsPort)
+	assert.Equal(t, defaults.Delivery.Timeout, cfg.Delivery.Timeout)
+	assert.True(t, cfg.Enabled(AdmissionWebhooks))
+}
+
+func TestFlags_FlagOverridesFile(t *testing.T) {
+	// Flags take precedence regardless of their position relative to --config
+	path, cleanup := writeConfig(t, testConfig)
+	defer cleanup()
+	cfg, err := completeFlags("--metrics-port", "9191", "--config", path,
+		"--delivery-retries", "1", "--watch-namespaces", "a,b")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(9191), cfg.Metrics.Port)
+	assert.Equal(t, 1, cfg.Delivery.Retries)
+	assert.Equal(t, []string{"a", "b"}, cfg.WatchNamespaces)
+	// Not overridden
+	assert.Equal(t, time.Second, cfg.Delivery.RetryBackoff.Duration)
+}
+
+func TestFlags_FeatureGatesMergeWithFile(t *testing.T) {
+	path, cleanup := writeConfig(t, testConfig)
+	defer cleanup()
+	cfg, err := completeFlags("--config", path, "--feature-gates", "TargetWatches=true")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[Feature]bool{ReportStream: false, TargetWatches: true}, cfg.FeatureGates)
+	assert.True(t, cfg.Enabled(AdmissionWebhooks))
+	assert.False(t, cfg.Enabled(ReportStream))
+	assert.True(t, cfg.Enabled(TargetWatches))
+
+	_, err = completeFlags("--feature-gates", "Unknown=true")
+	assert.Error(t, err)
+	_, err = completeFlags("--feature-gates", "ReportStream")
+	assert.Error(t, err)
+}
+
+func TestFlags_InvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "unknown key",
+			content: testConfig + "unknownKey: true\n",
+		},
+		{
+			name: "unknown nested key",
+			content: `apiVersion: config.metrics.wingsofovnia.github.com/v1alpha1
+kind: OperatorConfig
+delivery:
+  retryBackof: 1s
+`,
+		},
+		{
+			name: "wrong apiVersion",
+			content: `apiVersion: config.metrics.wingsofovnia.github.com/v1
+kind: OperatorConfig
+`,
+		},
+		{
+			name: "wrong kind",
+			content: `apiVersion: config.metrics.wingsofovnia.github.com/v1alpha1
+kind: ControllerConfig
+`,
+		},
+		{
+			name: "invalid value",
+			content: `apiVersion: config.metrics.wingsofovnia.github.com/v1alpha1
+kind: OperatorConfig
+maxConcurrentReconciles: 0
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, cleanup := writeConfig(t, test.content)
+			defer cleanup()
+			_, err := completeFlags("--config", path)
+			assert.Error(t, err)
+		})
+	}
+}
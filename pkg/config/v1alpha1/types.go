@@ -0,0 +1,288 @@
+// Package v1alpha1 contains the v1alpha1 operator configuration file format,
+// read by the manager on start with --config
+package v1alpha1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// SchemeGroupVersion is the apiVersion of operator configuration files
+var SchemeGroupVersion = schema.GroupVersion{Group: "config.metrics.wingsofovnia.github.com", Version: "v1alpha1"}
+
+const Kind = "OperatorConfig"
+
+// OperatorConfig configures the operator process, the values not set
+// in the file are defaulted, see DefaultOperatorConfig
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// WatchNamespaces are the namespaces MetricWebhooks are reconciled in,
+	// the empty namespace watches all of them. If not set, the WATCH_NAMESPACE
+	// environment variable is used.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// Metrics configures the operator and custom resource metrics endpoints
+	Metrics MetricsConfig `json:"metrics"`
+	// Webhook configures the admission webhook server
+	Webhook WebhookServerConfig `json:"webhook"`
+	// Stream configures the report stream server
+	Stream StreamConfig `json:"stream"`
+	// Delivery configures how metric reports are POSTed to webhooks
+	Delivery DeliveryConfig `json:"delivery"`
+	// MaxConcurrentReconciles is the number of MetricWebhooks reconciled at once
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles"`
+	// LeaderElection configures how a single active operator replica is elected
+	LeaderElection LeaderElectionConfig `json:"leaderElection"`
+	// FeatureGates enables or disables operator features by name, see Feature
+	FeatureGates map[Feature]bool `json:"featureGates,omitempty"`
+}
+
+type MetricsConfig struct {
+	// Host is the host the metrics endpoints bind to
+	Host string `json:"host"`
+	// Port serves the operator metrics, including the metricwebhook_ ones
+	Port int32 `json:"port"`
+	// CRMetricsPort serves the custom resource metrics
+	CRMetricsPort int32 `json:"crMetricsPort"`
+}
+
+type WebhookServerConfig struct {
+	// Port is the port the admission webhook server binds to
+	Port int `json:"port"`
+}
+
+type StreamConfig struct {
+	// BindAddress is the address metric reports are streamed on to subscribers
+	BindAddress string `json:"bindAddress"`
+}
+
+type DeliveryConfig struct {
+	// Timeout limits a single POST of a metric report to a webhook
+	Timeout metav1.Duration `json:"timeout"`
+	// Retries is how many times a delivery failed with a retryable error is retried
+	Retries int `json:"retries"`
+	// RetryBackoff is the delay before the first retry, doubled on each next one
+	RetryBackoff metav1.Duration `json:"retryBackoff"`
+}
+
+type LeaderElectionMode string
+
+const (
+	// LeaderForLifeMode elects the leader with a ConfigMap owned by the leader
+	// pod, so that the lock is released once the pod is deleted. Leader election
+	// is skipped if the operator runs outside of a cluster.
+	LeaderForLifeMode LeaderElectionMode = "LeaderForLife"
+	// LeaseMode elects the leader with a lease renewed by the leader,
+	// failing over within LeaseDuration if the leader becomes unavailable
+	LeaseMode LeaderElectionMode = "Lease"
+)
+
+type LeaderElectionConfig struct {
+	// LeaderElect enables leader election, disable only if running a single replica
+	LeaderElect bool `json:"leaderElect"`
+	// Mode is either LeaderForLife or Lease
+	Mode LeaderElectionMode `json:"mode"`
+	// LockName is the name of the ConfigMap used as the lock
+	LockName string `json:"lockName"`
+	// Namespace is the namespace of the lock in Lease mode, defaults to the
+	// namespace of the operator. LeaderForLife always uses the latter.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// LeaseDuration is how long non-leaders wait before taking over the lease
+	LeaseDuration metav1.Duration `json:"leaseDuration"`
+	// RenewDeadline is how long the leader retries renewing the lease
+	RenewDeadline metav1.Duration `json:"renewDeadline"`
+	// RetryPeriod is the delay between attempts to acquire or renew the lease
+	RetryPeriod metav1.Duration `json:"retryPeriod"`
+}
+
+// Feature is the name of a feature gate
+type Feature string
+
+const (
+	// AdmissionWebhooks serves the defaulting and validating admission webhooks,
+	// disable to run the operator without serving certificates, e.g. locally
+	AdmissionWebhooks Feature = "AdmissionWebhooks"
+	// ReportStream streams metric reports to subscribers on Stream.BindAddress
+	ReportStream Feature = "ReportStream"
+	// TargetWatches watches the pods selected as webhook targets to catch up
+	// new ones with the current alert state
+	TargetWatches Feature = "TargetWatches"
+)
+
+// defaultFeatureGates lists all known features with their defaults
+var defaultFeatureGates = map[Feature]bool{
+	AdmissionWebhooks: true,
+	ReportStream:      true,
+	TargetWatches:     true,
+}
+
+// DefaultOperatorConfig returns the configuration the operator runs with
+// unless a configuration file or flags are given
+func DefaultOperatorConfig() *OperatorConfig {
+	return &OperatorConfig{
+		TypeMeta: metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: Kind},
+		Metrics: MetricsConfig{
+			Host:          "0.0.0.0",
+			Port:          8383,
+			CRMetricsPort: 8686,
+		},
+		Webhook: WebhookServerConfig{
+			Port: 9443,
+		},
+		Stream: StreamConfig{
+			BindAddress: "0.0.0.0:8484",
+		},
+		Delivery: DeliveryConfig{
+			Timeout:      metav1.Duration{Duration: 3 * time.Second},
+			Retries:      2,
+			RetryBackoff: metav1.Duration{Duration: 500 * time.Millisecond},
+		},
+		MaxConcurrentReconciles: 1,
+		LeaderElection: LeaderElectionConfig{
+			LeaderElect:   true,
+			Mode:          LeaderForLifeMode,
+			LockName:      "metrics-webhook-lock",
+			LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+			RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+			RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+		},
+	}
+}
+
+// Enabled tells whether the feature is enabled, falling back to its default
+func (c *OperatorConfig) Enabled(feature Feature) bool {
+	if enabled, set := c.FeatureGates[feature]; set {
+		return enabled
+	}
+	return defaultFeatureGates[feature]
+}
+
+// LoadFile reads the configuration file at path into c, overriding
+// the values set in the file only
+func (c *OperatorConfig) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read operator config: %v", err)
+	}
+
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return fmt.Errorf("failed to decode operator config %s: %v", path, err)
+	}
+	if typeMeta.APIVersion != SchemeGroupVersion.String() || typeMeta.Kind != Kind {
+		return fmt.Errorf("unsupported operator config %s: apiVersion = %q, kind = %q, expected %s %s",
+			path, typeMeta.APIVersion, typeMeta.Kind, SchemeGroupVersion, Kind)
+	}
+
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("failed to decode operator config %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration for values the operator cannot run with
+func (c *OperatorConfig) Validate() field.ErrorList {
+	var errs field.ErrorList
+
+	if len(c.WatchNamespaces) > 1 {
+		for i, namespace := range c.WatchNamespaces {
+			if namespace == "" {
+				errs = append(errs, field.Invalid(field.NewPath("watchNamespaces").Index(i), namespace,
+					"all namespaces cannot be watched along with other ones"))
+			}
+		}
+	}
+
+	metricsPath := field.NewPath("metrics")
+	errs = append(errs, validatePort(metricsPath.Child("port"), int(c.Metrics.Port))...)
+	errs = append(errs, validatePort(metricsPath.Child("crMetricsPort"), int(c.Metrics.CRMetricsPort))...)
+	errs = append(errs, validatePort(field.NewPath("webhook", "port"), c.Webhook.Port)...)
+	if c.Stream.BindAddress == "" {
+		errs = append(errs, field.Required(field.NewPath("stream", "bindAddress"), ""))
+	}
+
+	deliveryPath := field.NewPath("delivery")
+	if c.Delivery.Timeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(deliveryPath.Child("timeout"), c.Delivery.Timeout.Duration.String(),
+			"must be positive"))
+	}
+	if c.Delivery.Retries < 0 {
+		errs = append(errs, field.Invalid(deliveryPath.Child("retries"), c.Delivery.Retries, "must not be negative"))
+	}
+	if c.Delivery.RetryBackoff.Duration < 0 {
+		errs = append(errs, field.Invalid(deliveryPath.Child("retryBackoff"), c.Delivery.RetryBackoff.Duration.String(),
+			"must not be negative"))
+	}
+
+	if c.MaxConcurrentReconciles < 1 {
+		errs = append(errs, field.Invalid(field.NewPath("maxConcurrentReconciles"), c.MaxConcurrentReconciles,
+			"must be at least 1"))
+	}
+
+	errs = append(errs, c.LeaderElection.validate(field.NewPath("leaderElection"))...)
+
+	for feature := range c.FeatureGates {
+		if _, known := defaultFeatureGates[feature]; !known {
+			errs = append(errs, field.NotSupported(field.NewPath("featureGates"), feature, knownFeatures()))
+		}
+	}
+	return errs
+}
+
+func (c *LeaderElectionConfig) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if !c.LeaderElect {
+		return errs
+	}
+
+	switch c.Mode {
+	case LeaderForLifeMode, LeaseMode:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("mode"), c.Mode,
+			[]string{string(LeaderForLifeMode), string(LeaseMode)}))
+	}
+	if c.LockName == "" {
+		errs = append(errs, field.Required(path.Child("lockName"), ""))
+	}
+	if c.Mode != LeaseMode {
+		return errs
+	}
+
+	if c.RetryPeriod.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("retryPeriod"), c.RetryPeriod.Duration.String(),
+			"must be positive"))
+	}
+	if c.RenewDeadline.Duration <= c.RetryPeriod.Duration {
+		errs = append(errs, field.Invalid(path.Child("renewDeadline"), c.RenewDeadline.Duration.String(),
+			"must be greater than retryPeriod"))
+	}
+	if c.LeaseDuration.Duration <= c.RenewDeadline.Duration {
+		errs = append(errs, field.Invalid(path.Child("leaseDuration"), c.LeaseDuration.Duration.String(),
+			"must be greater than renewDeadline"))
+	}
+	return errs
+}
+
+func validatePort(path *field.Path, port int) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(path, port, "must be between 1 and 65535")}
+	}
+	return nil
+}
+
+func knownFeatures() []string {
+	var features []string
+	for feature := range defaultFeatureGates {
+		features = append(features, string(feature))
+	}
+	sort.Strings(features)
+	return features
+}
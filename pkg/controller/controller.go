@@ -1,16 +1,18 @@
 package controller
 
 import (
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
+
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
-var AddToManagerFuncs []func(manager.Manager) error
+var AddToManagerFuncs []func(manager.Manager, *configv1alpha1.OperatorConfig) error
 
-// AddToManager adds all Controllers to the Manager
-func AddToManager(m manager.Manager) error {
+// AddToManager adds all Controllers to the Manager, configured with cfg
+func AddToManager(m manager.Manager, cfg *configv1alpha1.OperatorConfig) error {
 	for _, f := range AddToManagerFuncs {
-		if err := f(m); err != nil {
+		if err := f(m, cfg); err != nil {
 			return err
 		}
 	}
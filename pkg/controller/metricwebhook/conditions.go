@@ -0,0 +1,99 @@
+package metricwebhook
+
+import (
+	"strings"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Condition reasons
+const (
+	ReasonInvalidSpec         = "InvalidSpec"
+	ReasonReconciled          = "Reconciled"
+	ReasonMetricsFetched      = "MetricsFetched"
+	ReasonFetchFailed         = "FetchFailed"
+	ReasonMetricsStale        = "MetricsStale"
+	ReasonTargetsResolved     = "TargetsResolved"
+	ReasonNoTargets           = "NoTargets"
+	ReasonResolveFailed       = "ResolveFailed"
+	ReasonReportDelivered     = "ReportDelivered"
+	ReasonDeliveryFailed      = "DeliveryFailed"
+	ReasonNoReportSent        = "NoReportSent"
+	ReasonMetricsAboveTarget  = "MetricsAboveTarget"
+	ReasonMetricsWithinTarget = "MetricsWithinTarget"
+	ReasonSuspended           = "Suspended"
+)
+
+func setCondition(metricWebhook *metricsv1alpha1.MetricWebhook, conditionType metricsv1alpha1.MetricWebhookConditionType,
+	status v1.ConditionStatus, reason, message string) {
+	metricWebhook.Status.SetCondition(metricsv1alpha1.MetricWebhookCondition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: metricWebhook.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// scrapeConditions are the conditions set by scrapes, summarized by Ready
+var scrapeConditions = []metricsv1alpha1.MetricWebhookConditionType{
+	metricsv1alpha1.MetricsAvailableCondition,
+	metricsv1alpha1.TargetsResolvedCondition,
+	metricsv1alpha1.WebhookDeliveringCondition,
+	metricsv1alpha1.AlertingCondition,
+}
+
+// copyConditions sets the conditions of the types as they are in from onto to,
+// removing the ones from does not have
+func copyConditions(from, to *metricsv1alpha1.MetricWebhookStatus, conditionTypes ...metricsv1alpha1.MetricWebhookConditionType) {
+	for _, conditionType := range conditionTypes {
+		if condition := from.GetCondition(conditionType); condition != nil {
+			to.SetCondition(*condition)
+		} else {
+			to.RemoveCondition(conditionType)
+		}
+	}
+}
+
+// setReadyCondition summarizes the other conditions: the MetricWebhook is ready
+// once metrics are available, targets are resolved and no delivery has failed
+func setReadyCondition(metricWebhook *metricsv1alpha1.MetricWebhook) {
+	for _, conditionType := range []metricsv1alpha1.MetricWebhookConditionType{
+		metricsv1alpha1.MetricsAvailableCondition,
+		metricsv1alpha1.TargetsResolvedCondition,
+		metricsv1alpha1.WebhookDeliveringCondition,
+	} {
+		condition := metricWebhook.Status.GetCondition(conditionType)
+		if condition == nil {
+			if conditionType == metricsv1alpha1.WebhookDeliveringCondition {
+				continue
+			}
+			setCondition(metricWebhook, metricsv1alpha1.ReadyCondition, v1.ConditionUnknown, ReasonReconciled,
+				string(conditionType)+" has not been observed yet")
+			return
+		}
+		if condition.Status == v1.ConditionFalse {
+			setCondition(metricWebhook, metricsv1alpha1.ReadyCondition, v1.ConditionFalse, condition.Reason, condition.Message)
+			return
+		}
+	}
+	setCondition(metricWebhook, metricsv1alpha1.ReadyCondition, v1.ConditionTrue, ReasonReconciled, "")
+}
+
+// setAlertingCondition lists the metrics exceeding their targets as of the last scrape
+func setAlertingCondition(metricWebhook *metricsv1alpha1.MetricWebhook) {
+	var alertingMetrics []string
+	for _, metric := range metricWebhook.Status.Metrics {
+		if metric.Alerting {
+			alertingMetrics = append(alertingMetrics, metric.MetricName())
+		}
+	}
+	if len(alertingMetrics) > 0 {
+		setCondition(metricWebhook, metricsv1alpha1.AlertingCondition, v1.ConditionTrue, ReasonMetricsAboveTarget,
+			strings.Join(alertingMetrics, ", ")+" exceed(s) target")
+		return
+	}
+	setCondition(metricWebhook, metricsv1alpha1.AlertingCondition, v1.ConditionFalse, ReasonMetricsWithinTarget, "")
+}
@@ -0,0 +1,118 @@
+package metricwebhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSetReadyCondition(t *testing.T) {
+	available := metricsv1alpha1.MetricWebhookCondition{Type: metricsv1alpha1.MetricsAvailableCondition,
+		Status: v1.ConditionTrue, Reason: ReasonMetricsFetched}
+	resolved := metricsv1alpha1.MetricWebhookCondition{Type: metricsv1alpha1.TargetsResolvedCondition,
+		Status: v1.ConditionTrue, Reason: ReasonTargetsResolved}
+	delivering := metricsv1alpha1.MetricWebhookCondition{Type: metricsv1alpha1.WebhookDeliveringCondition,
+		Status: v1.ConditionTrue, Reason: ReasonReportDelivered}
+	deliveryFailed := metricsv1alpha1.MetricWebhookCondition{Type: metricsv1alpha1.WebhookDeliveringCondition,
+		Status: v1.ConditionFalse, Reason: ReasonDeliveryFailed, Message: "1 of 2 webhook target(s) failed"}
+	fetchFailed := metricsv1alpha1.MetricWebhookCondition{Type: metricsv1alpha1.MetricsAvailableCondition,
+		Status: v1.ConditionFalse, Reason: ReasonFetchFailed, Message: "1 of 1 metric(s) failed"}
+
+	tests := []struct {
+		name       string
+		conditions []metricsv1alpha1.MetricWebhookCondition
+		status     v1.ConditionStatus
+		reason     string
+		message    string
+	}{
+		{
+			name:       "all true",
+			conditions: []metricsv1alpha1.MetricWebhookCondition{available, resolved, delivering},
+			status:     v1.ConditionTrue,
+			reason:     ReasonReconciled,
+		},
+		{
+			name:       "nothing delivered yet",
+			conditions: []metricsv1alpha1.MetricWebhookCondition{available, resolved},
+			status:     v1.ConditionTrue,
+			reason:     ReasonReconciled,
+		},
+		{
+			name:       "delivery failed",
+			conditions: []metricsv1alpha1.MetricWebhookCondition{available, resolved, deliveryFailed},
+			status:     v1.ConditionFalse,
+			reason:     ReasonDeliveryFailed,
+			message:    deliveryFailed.Message,
+		},
+		{
+			name:       "fetch failed before delivery failed",
+			conditions: []metricsv1alpha1.MetricWebhookCondition{deliveryFailed, resolved, fetchFailed},
+			status:     v1.ConditionFalse,
+			reason:     ReasonFetchFailed,
+			message:    fetchFailed.Message,
+		},
+		{
+			name:       "targets not observed yet",
+			conditions: []metricsv1alpha1.MetricWebhookCondition{available, delivering},
+			status:     v1.ConditionUnknown,
+			reason:     ReasonReconciled,
+			message:    "TargetsResolved has not been observed yet",
+		},
+		{
+			name:    "nothing observed yet",
+			status:  v1.ConditionUnknown,
+			reason:  ReasonReconciled,
+			message: "MetricsAvailable has not been observed yet",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metricWebhook := &metricsv1alpha1.MetricWebhook{}
+			metricWebhook.Generation = 3
+			metricWebhook.Status.Conditions = test.conditions
+
+			setReadyCondition(metricWebhook)
+
+			ready := metricWebhook.Status.GetCondition(metricsv1alpha1.ReadyCondition)
+			if assert.NotNil(t, ready) {
+				assert.Equal(t, test.status, ready.Status)
+				assert.Equal(t, test.reason, ready.Reason)
+				assert.Equal(t, test.message, ready.Message)
+				assert.Equal(t, int64(3), ready.ObservedGeneration)
+			}
+		})
+	}
+}
+
+func TestSetAlertingCondition(t *testing.T) {
+	utilization := int32(50)
+	metricWebhook := &metricsv1alpha1.MetricWebhook{}
+	metricWebhook.Status.Metrics = []metricsv1alpha1.MetricStatus{
+		{
+			Type:     metricsv1alpha1.ResourceMetricSourceType,
+			Alerting: true,
+			Resource: &metricsv1alpha1.ResourceMetricStatus{Name: v1.ResourceCPU, TargetAverageUtilization: &utilization},
+		},
+		{
+			Type:     metricsv1alpha1.PodsMetricSourceType,
+			Alerting: false,
+			Pods:     &metricsv1alpha1.PodsMetricStatus{Name: "requests_per_second", TargetAverageValue: resource.MustParse("100")},
+		},
+	}
+
+	setAlertingCondition(metricWebhook)
+	alerting := metricWebhook.Status.GetCondition(metricsv1alpha1.AlertingCondition)
+	assert.Equal(t, v1.ConditionTrue, alerting.Status)
+	assert.Equal(t, ReasonMetricsAboveTarget, alerting.Reason)
+	assert.Equal(t, "cpu exceed(s) target", alerting.Message)
+
+	metricWebhook.Status.Metrics[0].Alerting = false
+	setAlertingCondition(metricWebhook)
+	alerting = metricWebhook.Status.GetCondition(metricsv1alpha1.AlertingCondition)
+	assert.Equal(t, v1.ConditionFalse, alerting.Status)
+	assert.Equal(t, ReasonMetricsWithinTarget, alerting.Reason)
+}
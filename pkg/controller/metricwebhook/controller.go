@@ -2,39 +2,81 @@ package metricwebhook
 
 import (
 	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
+	"github.com/wingsofovnia/metrics-webhook/pkg/stream"
 
-	"github.com/operator-framework/operator-sdk/pkg/predicate"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const ControllerName = "metricwebhook-controller"
 
+// specChangedPredicate passes MetricWebhook updates changing the spec or
+// marking the MetricWebhook for deletion, ignoring status updates
+var specChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.MetaNew.GetGeneration() != e.MetaOld.GetGeneration() ||
+			e.MetaNew.GetDeletionTimestamp() != nil
+	},
+}
+
 // Add creates a new MetricWebhook Controller and adds it to the
 // Manager. It will start it when the Manager is started.
-func Add(mgr manager.Manager) error {
-	reconciler, err := NewReconcileMetricWebhook(mgr)
+func Add(mgr manager.Manager, cfg *configv1alpha1.OperatorConfig) error {
+	broker := stream.NewDefaultBroker()
+	if cfg.Enabled(configv1alpha1.ReportStream) {
+		clientSet, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(stream.NewServer(cfg.Stream.BindAddress, broker, stream.NewKubeAuthorizer(clientSet))); err != nil {
+			return err
+		}
+	}
+
+	reconciler, err := NewReconcileMetricWebhook(mgr, cfg, broker)
 	if err != nil {
 		return err
 	}
-	return add(mgr, reconciler)
+	return add(mgr, cfg, reconciler)
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
-	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+func add(mgr manager.Manager, cfg *configv1alpha1.OperatorConfig, r reconcile.Reconciler) error {
+	c, err := controller.New(ControllerName, mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: cfg.MaxConcurrentReconciles,
+	})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to primary resource MetricWebhook
-	err = c.Watch(&source.Kind{Type: &metricsv1alpha1.MetricWebhook{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{})
+	err = c.Watch(&source.Kind{Type: &metricsv1alpha1.MetricWebhook{}}, &handler.EnqueueRequestForObject{}, specChangedPredicate)
 	if err != nil {
 		return err
 	}
 
+	if !cfg.Enabled(configv1alpha1.TargetWatches) {
+		return nil
+	}
+
+	// Watch for changes to webhook targets of MetricWebhooks
+	targeting := &webhooksTargeting{client: mgr.GetClient()}
+	err = c.Watch(&source.Kind{Type: &v1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(targeting.pods),
+	}, podTargetChangedPredicate{})
+	if err != nil {
+		return err
+	}
+	// Services are not watched, a service target resolves to the service
+	// address regardless of the pods behind it, so it never gains new urls
 	return nil
 }
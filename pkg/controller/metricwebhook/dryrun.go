@@ -0,0 +1,58 @@
+package metricwebhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxDryRunReports is how many of the latest dry run reports the status keeps
+const maxDryRunReports = 10
+
+// recordDryRun records the metric report in the status of the MetricWebhook
+// along with the webhook urls it would have been delivered to, instead of
+// delivering it. The status is saved by the caller, the report recorded is
+// returned to be written onto the latest status, nil if it failed to render.
+func (r *MetricWebhookReconciler) recordDryRun(metricWebhook *metricsv1alpha1.MetricWebhook, metricReport metricsv1alpha1.MetricReport,
+	webhookUrls []string, resolveErr error) *metricsv1alpha1.DryRunReport {
+	name := types.NamespacedName{Namespace: metricWebhook.Namespace, Name: metricWebhook.Name}
+	reqLogger := r.logger.WithValues("Resource", name)
+
+	payload, err := json.Marshal(metricReport)
+	if err != nil {
+		reqLogger.Error(err, "failed to render dry run report")
+		return nil
+	}
+
+	dryRunReport := metricsv1alpha1.DryRunReport{
+		Time:    metav1.Now(),
+		Urls:    webhookUrls,
+		Payload: string(payload),
+	}
+	if resolveErr != nil {
+		dryRunReport.Error = resolveErr.Error()
+	}
+	appendDryRunReports(&metricWebhook.Status, dryRunReport)
+
+	reqLogger.Info("recording dry run report",
+		"Spec.Webhook.Url(resolved)", webhookUrls,
+		"metricReport", metricReport,
+	)
+	observeDryRunNotifications(name, metricReport)
+	r.eventRecorder.Event(metricWebhook, v1.EventTypeNormal, "DryRun",
+		fmt.Sprintf("would notify %d webhook target(s): %s", len(webhookUrls), metricReport.String()))
+	return &dryRunReport
+}
+
+// appendDryRunReports appends the reports to the status, keeping the latest ones only
+func appendDryRunReports(status *metricsv1alpha1.MetricWebhookStatus, dryRunReports ...metricsv1alpha1.DryRunReport) {
+	status.DryRunReports = append(status.DryRunReports, dryRunReports...)
+	if len(status.DryRunReports) > maxDryRunReports {
+		status.DryRunReports = status.DryRunReports[len(status.DryRunReports)-maxDryRunReports:]
+	}
+}
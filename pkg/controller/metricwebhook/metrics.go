@@ -0,0 +1,220 @@
+package metricwebhook
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "metricwebhook"
+
+// Operator metrics are registered with the controller-runtime registry,
+// served by the manager on metricsPort along with the default ones
+var (
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Latency of metric fetches from the metrics APIs by metric source type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+	fetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_errors_total",
+		Help:      "Number of failed metric fetches by metric source type.",
+	}, []string{"type"})
+	metricCurrent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "metric_current_value",
+		Help:      "Current average value (or utilization, if targeted) of a MetricWebhook metric.",
+	}, []string{"namespace", "name", "metric"})
+	metricTarget = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "metric_target_value",
+		Help:      "Target average value (or utilization) of a MetricWebhook metric.",
+	}, []string{"namespace", "name", "metric"})
+	metricAlerting = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "metric_alerting",
+		Help:      "Whether a MetricWebhook metric exceeds its target (1) or not (0).",
+	}, []string{"namespace", "name", "metric"})
+	notificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notifications_sent_total",
+		Help:      "Number of metric notifications delivered to webhooks by notification type.",
+	}, []string{"namespace", "name", "type"})
+	dryRunNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dry_run_notifications_total",
+		Help:      "Number of metric notifications recorded rather than delivered in DryRun mode by notification type.",
+	}, []string{"namespace", "name", "type"})
+	deliveryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "delivery_duration_seconds",
+		Help:      "Latency of metric report delivery attempts by MetricWebhook and webhook endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "name", "endpoint"})
+	deliveryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "delivery_failures_total",
+		Help:      "Number of failed metric report delivery attempts by MetricWebhook and webhook endpoint.",
+	}, []string{"namespace", "name", "endpoint"})
+	deliveryResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "delivery_responses_total",
+		Help:      "Number of webhook responses by MetricWebhook, webhook endpoint and status code.",
+	}, []string{"namespace", "name", "endpoint", "code"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		fetchDuration,
+		fetchErrors,
+		metricCurrent,
+		metricTarget,
+		metricAlerting,
+		notificationsSent,
+		dryRunNotifications,
+		deliveryDuration,
+		deliveryFailures,
+		deliveryResponses,
+	)
+}
+
+func observeFetch(sourceType metricsv1alpha1.MetricSourceType, start time.Time, err error) {
+	fetchDuration.WithLabelValues(string(sourceType)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		fetchErrors.WithLabelValues(string(sourceType)).Inc()
+	}
+}
+
+// observedDeliveries tracks the delivery series exported per MetricWebhook,
+// by webhook endpoint and response status code, so that they can be dropped
+// once the endpoint is changed or the MetricWebhook is deleted
+var observedDeliveries = struct {
+	sync.Mutex
+	codes map[types.NamespacedName]map[string]map[string]bool
+}{codes: make(map[types.NamespacedName]map[string]map[string]bool)}
+
+func observeDelivery(webhook types.NamespacedName, endpoint string, start time.Time, statusCode int, err error) {
+	observedDeliveries.Lock()
+	defer observedDeliveries.Unlock()
+
+	codes := observedDeliveries.codes[webhook][endpoint]
+	if codes == nil {
+		// Delivered to a new endpoint, the series of the previous one are stale
+		forgetEndpoints(webhook)
+		codes = make(map[string]bool)
+		observedDeliveries.codes[webhook] = map[string]map[string]bool{endpoint: codes}
+	}
+
+	deliveryDuration.WithLabelValues(webhook.Namespace, webhook.Name, endpoint).Observe(time.Since(start).Seconds())
+	if statusCode != 0 {
+		code := strconv.Itoa(statusCode)
+		deliveryResponses.WithLabelValues(webhook.Namespace, webhook.Name, endpoint, code).Inc()
+		codes[code] = true
+	}
+	if err != nil {
+		deliveryFailures.WithLabelValues(webhook.Namespace, webhook.Name, endpoint).Inc()
+	}
+}
+
+func forgetDeliveries(webhook types.NamespacedName) {
+	observedDeliveries.Lock()
+	defer observedDeliveries.Unlock()
+
+	forgetEndpoints(webhook)
+}
+
+// forgetEndpoints drops the delivery series of the MetricWebhook, the caller
+// holds the observedDeliveries lock
+func forgetEndpoints(webhook types.NamespacedName) {
+	for endpoint, codes := range observedDeliveries.codes[webhook] {
+		deliveryDuration.DeleteLabelValues(webhook.Namespace, webhook.Name, endpoint)
+		deliveryFailures.DeleteLabelValues(webhook.Namespace, webhook.Name, endpoint)
+		for code := range codes {
+			deliveryResponses.DeleteLabelValues(webhook.Namespace, webhook.Name, endpoint, code)
+		}
+	}
+	delete(observedDeliveries.codes, webhook)
+}
+
+func observeNotificationsSent(webhook types.NamespacedName, report metricsv1alpha1.MetricReport) {
+	for _, notification := range report {
+		notificationsSent.WithLabelValues(webhook.Namespace, webhook.Name, string(notification.Type)).Inc()
+	}
+}
+
+func observeDryRunNotifications(webhook types.NamespacedName, report metricsv1alpha1.MetricReport) {
+	for _, notification := range report {
+		dryRunNotifications.WithLabelValues(webhook.Namespace, webhook.Name, string(notification.Type)).Inc()
+	}
+}
+
+// observedMetrics tracks the metric names exported per MetricWebhook so that
+// series of removed metrics and deleted MetricWebhooks can be dropped
+var observedMetrics = struct {
+	sync.Mutex
+	names map[types.NamespacedName]map[string]bool
+}{names: make(map[types.NamespacedName]map[string]bool)}
+
+func observeMetricStatuses(webhook types.NamespacedName, statuses []metricsv1alpha1.MetricStatus) {
+	observedMetrics.Lock()
+	defer observedMetrics.Unlock()
+
+	names := make(map[string]bool)
+	for _, status := range statuses {
+		notification := metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Alert, status)
+		current, target := notificationValues(notification)
+		alerting := 0.0
+		if status.Alerting {
+			alerting = 1
+		}
+
+		labels := []string{webhook.Namespace, webhook.Name, notification.Name}
+		metricCurrent.WithLabelValues(labels...).Set(current)
+		metricTarget.WithLabelValues(labels...).Set(target)
+		metricAlerting.WithLabelValues(labels...).Set(alerting)
+		names[notification.Name] = true
+	}
+
+	for name := range observedMetrics.names[webhook] {
+		if !names[name] {
+			deleteMetricSeries(webhook, name)
+		}
+	}
+	observedMetrics.names[webhook] = names
+}
+
+func forgetMetricStatuses(webhook types.NamespacedName) {
+	observedMetrics.Lock()
+	defer observedMetrics.Unlock()
+
+	for name := range observedMetrics.names[webhook] {
+		deleteMetricSeries(webhook, name)
+	}
+	delete(observedMetrics.names, webhook)
+}
+
+func deleteMetricSeries(webhook types.NamespacedName, metric string) {
+	metricCurrent.DeleteLabelValues(webhook.Namespace, webhook.Name, metric)
+	metricTarget.DeleteLabelValues(webhook.Namespace, webhook.Name, metric)
+	metricAlerting.DeleteLabelValues(webhook.Namespace, webhook.Name, metric)
+}
+
+// notificationValues returns the utilization values if targeted, raw average values otherwise
+func notificationValues(notification metricsv1alpha1.MetricNotification) (current, target float64) {
+	if notification.TargetAverageUtilization != nil && notification.CurrentAverageUtilization != nil {
+		return float64(*notification.CurrentAverageUtilization), float64(*notification.TargetAverageUtilization)
+	}
+	current = float64(notification.CurrentAverageValue.MilliValue()) / 1000
+	if notification.TargetAverageValue != nil {
+		target = float64(notification.TargetAverageValue.MilliValue()) / 1000
+	}
+	return current, target
+}
@@ -0,0 +1,56 @@
+package metricwebhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWebhookEndpoint(t *testing.T) {
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}}
+	tests := []struct {
+		name     string
+		webhook  metricsv1alpha1.Webhook
+		endpoint string
+	}{
+		{
+			name:     "url",
+			webhook:  metricsv1alpha1.Webhook{Url: "http://app.example.com/hook"},
+			endpoint: "http://app.example.com/hook",
+		},
+		{
+			name:     "service",
+			webhook:  metricsv1alpha1.Webhook{Service: "app", Port: 4030},
+			endpoint: "service/app",
+		},
+		{
+			name:     "pods",
+			webhook:  metricsv1alpha1.Webhook{Port: 4030},
+			endpoint: "pods/app=app",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := metricsv1alpha1.MetricWebhookSpec{Selector: selector, Webhook: test.webhook}
+			assert.Equal(t, test.endpoint, webhookEndpoint(spec))
+		})
+	}
+}
+
+func TestObserveDelivery_EndpointChanged(t *testing.T) {
+	defer forgetDeliveries(testWebhook)
+
+	observeDelivery(testWebhook, "service/app", time.Now(), 500, errors.New("unavailable"))
+	observeDelivery(testWebhook, "pods/app=app", time.Now(), 200, nil)
+
+	// The series of the previous endpoint are dropped
+	assert.False(t, deliveryFailures.DeleteLabelValues(testWebhook.Namespace, testWebhook.Name, "service/app"))
+	assert.False(t, deliveryResponses.DeleteLabelValues(testWebhook.Namespace, testWebhook.Name, "service/app", "500"))
+	assert.Equal(t, map[string]map[string]bool{"pods/app=app": {"200": true}}, observedDeliveries.codes[testWebhook])
+}
@@ -2,52 +2,181 @@ package metricwebhook
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-const defaultHttpTimeout = time.Second * 3
+// DeliveryError describes a metric report the webhook failed to process
+type DeliveryError struct {
+	// StatusCode is the webhook response status, 0 if no response has been received
+	StatusCode int
+	// Body is the webhook response body
+	Body string
+	// Retryable tells whether delivering the same report again may succeed
+	Retryable bool
+
+	err error
+}
+
+func (e *DeliveryError) Error() string {
+	kind := "permanent"
+	if e.Retryable {
+		kind = "retryable"
+	}
+	if e.err != nil {
+		return fmt.Sprintf("webhook delivery failed (%s): %v", kind, e.err)
+	}
+	return fmt.Sprintf("webhook delivery failed (%s): status = %d, body = %s", kind, e.StatusCode, e.Body)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.err
+}
+
+// maxConcurrentDeliveries is how many webhook targets a report is delivered to at once
+const maxConcurrentDeliveries = 8
+
+// deliveryBudget is the fraction of the scrape interval the delivery of a
+// report may take, retries are given up beyond it so that the next scrape
+// is not delayed by unreachable targets
+const deliveryBudget = 0.5
+
+// deliveryContext limits the delivery of a report of a MetricWebhook
+// scraped every scrapeInterval, see deliveryBudget
+func deliveryContext(parent context.Context, scrapeInterval time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, time.Duration(deliveryBudget*float64(scrapeInterval)))
+}
+
+// deliveryResult is the outcome of delivering a report to a webhook target
+type deliveryResult struct {
+	webhookUrl string
+	statusCode int
+	err        error
+}
 
 type MetricNotificationClient struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	retries      int
+	retryBackoff time.Duration
 }
 
-func NewDefaultMetricAlertClient() *MetricNotificationClient {
-	return NewMetricAlertClient(&http.Client{
-		Timeout: defaultHttpTimeout,
-	})
+// NewMetricAlertClient creates a client delivering metric reports with the
+// timeout and retries of the operator configuration
+func NewMetricAlertClient(delivery configv1alpha1.DeliveryConfig) *MetricNotificationClient {
+	return &MetricNotificationClient{
+		httpClient: &http.Client{
+			Timeout: delivery.Timeout.Duration,
+		},
+		retries:      delivery.Retries,
+		retryBackoff: delivery.RetryBackoff.Duration,
+	}
 }
 
-func NewMetricAlertClient(httpClient *http.Client) *MetricNotificationClient {
-	return &MetricNotificationClient{httpClient: httpClient}
+// webhookEndpoint returns the webhook endpoint configured in spec the delivery
+// metrics are labelled with, that is the url, the service or the pod selector.
+// Pods are labelled by the selector rather than their IPs, that come and go
+// with the pods and would leave behind a series per pod ever targeted.
+func webhookEndpoint(spec v1alpha1.MetricWebhookSpec) string {
+	switch {
+	case spec.Webhook.Url != "":
+		return spec.Webhook.Url
+	case spec.Webhook.Service != "":
+		return "service/" + spec.Webhook.Service
+	default:
+		return "pods/" + metav1.FormatLabelSelector(&spec.Selector)
+	}
 }
 
-func (c *MetricNotificationClient) notify(webhookUrl string, report v1alpha1.MetricReport) error {
+// notifyAll delivers the report to the webhooks of the MetricWebhook concurrently,
+// at most maxConcurrentDeliveries at once, returning the results in the order of webhookUrls
+func (c *MetricNotificationClient) notifyAll(ctx context.Context, webhook types.NamespacedName, endpoint string,
+	webhookUrls []string, report v1alpha1.MetricReport) []deliveryResult {
+	results := make([]deliveryResult, len(webhookUrls))
+	slots := make(chan struct{}, maxConcurrentDeliveries)
+	var wg sync.WaitGroup
+	for i, webhookUrl := range webhookUrls {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, webhookUrl string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			statusCode, err := c.notify(ctx, webhook, endpoint, webhookUrl, report)
+			results[i] = deliveryResult{webhookUrl: webhookUrl, statusCode: statusCode, err: err}
+		}(i, webhookUrl)
+	}
+	wg.Wait()
+	return results
+}
+
+// notify delivers the report to the webhook, retrying failures the webhook
+// marks as retryable (5xx, 408, 429 or no response at all) with a doubling
+// backoff until ctx is done.
+// It returns the status code of the last response received, 202 meaning the
+// webhook accepted the report for processing later on.
+func (c *MetricNotificationClient) notify(ctx context.Context, webhook types.NamespacedName, endpoint string,
+	webhookUrl string, report v1alpha1.MetricReport) (int, error) {
 	reqBodyBytes, err := json.Marshal(report)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	var statusCode int
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		statusCode, err = c.deliver(ctx, webhookUrl, reqBodyBytes)
+		observeDelivery(webhook, endpoint, start, statusCode, err)
+		if deliveryErr, failed := err.(*DeliveryError); !failed || !deliveryErr.Retryable || attempt >= c.retries {
+			return statusCode, err
+		}
+
+		backoff := c.retryBackoff << uint(attempt)
+		if deadline, set := ctx.Deadline(); set && time.Now().Add(backoff).After(deadline) {
+			return statusCode, err
+		}
+		select {
+		case <-ctx.Done():
+			return statusCode, err
+		case <-time.After(backoff):
+		}
 	}
+}
 
-	req, err := http.NewRequest("POST", webhookUrl, bytes.NewBuffer(reqBodyBytes))
+func (c *MetricNotificationClient) deliver(ctx context.Context, webhookUrl string, reqBodyBytes []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookUrl, bytes.NewBuffer(reqBodyBytes))
 	if err != nil {
-		return err
+		return 0, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return 0, &DeliveryError{Retryable: true, err: err}
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
+	switch {
+	case res.StatusCode == http.StatusOK || res.StatusCode == http.StatusAccepted:
+		return res.StatusCode, nil
+	default:
 		resBodyStr, _ := ioutil.ReadAll(res.Body)
-		return fmt.Errorf("unexpected webhook response: status = %d, body = %s", res.StatusCode, resBodyStr)
+		return res.StatusCode, &DeliveryError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBodyStr),
+			Retryable: res.StatusCode >= 500 ||
+				res.StatusCode == http.StatusRequestTimeout ||
+				res.StatusCode == http.StatusTooManyRequests,
+		}
 	}
-
-	return nil
 }
@@ -4,17 +4,22 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"net/http"
 	"time"
 
 	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
+	"github.com/wingsofovnia/metrics-webhook/pkg/stream"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/kubernetes/pkg/controller/podautoscaler/metrics"
 	metricsclientv1beta1 "k8s.io/metrics/pkg/client/clientset/versioned/typed/metrics/v1beta1"
 	"k8s.io/metrics/pkg/client/custom_metrics"
@@ -30,14 +35,18 @@ const ReconcilerName = "metricwebhook-reconciler"
 
 type MetricWebhookReconciler struct {
 	client                   client.Client
+	apiReader                client.Reader
 	scheme                   *runtime.Scheme
 	metricsClient            *MetricMeasurementClient
 	metricNotificationClient *MetricNotificationClient
 	eventRecorder            record.EventRecorder
+	reportBroker             *stream.Broker
+	scheduler                *Scheduler
+	targets                  *targetSet
 	logger                   logr.Logger
 }
 
-func NewReconcileMetricWebhook(mgr manager.Manager) (reconcile.Reconciler, error) {
+func NewReconcileMetricWebhook(mgr manager.Manager, cfg *configv1alpha1.OperatorConfig, reportBroker *stream.Broker) (reconcile.Reconciler, error) {
 	restMapper := mgr.GetRESTMapper()
 	clientSet, err := kubernetes.NewForConfig(mgr.GetConfig())
 	if err != nil {
@@ -51,19 +60,27 @@ func NewReconcileMetricWebhook(mgr manager.Manager) (reconcile.Reconciler, error
 		external_metrics.NewForConfigOrDie(mgr.GetConfig()),
 	)
 
-	return &MetricWebhookReconciler{
+	reconciler := &MetricWebhookReconciler{
 		client:                   mgr.GetClient(),
+		apiReader:                mgr.GetAPIReader(),
 		scheme:                   mgr.GetScheme(),
 		metricsClient:            NewMetricValuesClient(metricsClient, clientSet),
-		metricNotificationClient: NewDefaultMetricAlertClient(),
+		metricNotificationClient: NewMetricAlertClient(cfg.Delivery),
 		eventRecorder:            mgr.GetEventRecorderFor(ControllerName),
+		reportBroker:             reportBroker,
+		targets:                  newTargetSet(),
 		logger:                   logf.Log.WithName(ReconcilerName),
-	}, nil
+	}
+	reconciler.scheduler = NewScheduler(reconciler.scrape, DefaultScrapeJitter)
+	if err := mgr.Add(reconciler.scheduler); err != nil {
+		return &MetricWebhookReconciler{}, err
+	}
+	return reconciler, nil
 }
 
 // Reconcile reads that state of the cluster for a MetricWebhook object and
-// sends out metric notification based on the config defined in MetricWebhook.Spec
-// and current metric measurements
+// (re)schedules scraping its metrics every MetricWebhook.Spec.ScrapeInterval,
+// the metric notifications are sent out by scrape
 func (r *MetricWebhookReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	reqLogger := r.logger.WithValues("Resource", request.NamespacedName)
 
@@ -71,14 +88,120 @@ func (r *MetricWebhookReconciler) Reconcile(request reconcile.Request) (reconcil
 	metricWebhook := &metricsv1alpha1.MetricWebhook{}
 	err := r.client.Get(context.TODO(), request.NamespacedName, metricWebhook)
 	if err != nil {
-		reqLogger.Error(err, "failed to fetch MetricWebhook instance")
 		if errors.IsNotFound(err) {
-			return reconcile.Result{Requeue: false}, nil
+			r.scheduler.Unschedule(request.NamespacedName)
+			r.targets.forget(request.NamespacedName)
+			forgetMetricStatuses(request.NamespacedName)
+			forgetDeliveries(request.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		reqLogger.Error(err, "failed to fetch MetricWebhook instance")
+		return reconcile.Result{}, err
+	}
+
+	// Withdraw alerting metrics before the MetricWebhook is gone
+	if metricWebhook.DeletionTimestamp != nil {
+		r.scheduler.Unschedule(request.NamespacedName)
+		if err := r.finalize(metricWebhook); err != nil {
+			if errors.IsConflict(err) {
+				// Finalize again as of the latest version
+				return reconcile.Result{Requeue: true}, nil
+			}
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// Reject specs admitted before the admission webhooks were installed
+	metricWebhook.Default()
+	if errs := metricWebhook.Validate(); len(errs) > 0 {
+		r.scheduler.Unschedule(request.NamespacedName)
+		r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, ReasonInvalidSpec, errs.ToAggregate().Error())
+		reqLogger.Info("invalid MetricWebhook spec, waiting for it to be fixed", "errors", errs.ToAggregate().Error())
+
+		err := r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+			setCondition(latest, metricsv1alpha1.ReadyCondition, v1.ConditionFalse, ReasonInvalidSpec, errs.ToAggregate().Error())
+		})
+		if err != nil {
+			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSaveStatus", err.Error())
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// The finalizer is added once the spec is valid as the update is validated on admission
+	if err := r.addFinalizer(metricWebhook); err != nil {
+		if errors.IsConflict(err) {
+			// Finalizers have been changed meanwhile, add it to the latest ones
+			return reconcile.Result{Requeue: true}, nil
 		}
 		return reconcile.Result{}, err
 	}
+	if err := r.withdrawRemovedMetrics(metricWebhook); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.switchMode(metricWebhook); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if metricWebhook.Spec.Mode == metricsv1alpha1.SuspendedMode {
+		r.scheduler.Unschedule(request.NamespacedName)
+		err := r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+			setCondition(latest, metricsv1alpha1.ReadyCondition, v1.ConditionFalse, ReasonSuspended, "scraping is suspended")
+		})
+		if err != nil {
+			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSaveStatus", err.Error())
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	r.scheduler.Schedule(request.NamespacedName, metricWebhook.Spec.ScrapeInterval.Duration)
+	r.catchUp(metricWebhook)
+	return reconcile.Result{}, nil
+}
+
+// scrape fetches current metric values of the MetricWebhook, updates its status
+// and sends out metric notifications based on the config defined in MetricWebhook.Spec,
+// it is called by the scheduler every MetricWebhook.Spec.ScrapeInterval. The
+// delivery is given up once ctx is done, that is once the scrape is unscheduled.
+func (r *MetricWebhookReconciler) scrape(ctx context.Context, name types.NamespacedName) error {
+	reqLogger := r.logger.WithValues("Resource", name)
+
+	// Fetch the MetricWebhook instance
+	metricWebhook := &metricsv1alpha1.MetricWebhook{}
+	err := r.client.Get(ctx, name, metricWebhook)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Reconcile unschedules deleted MetricWebhooks
+			return nil
+		}
+		return err
+	}
+	metricWebhook.Default()
+	if errs := metricWebhook.Validate(); len(errs) > 0 {
+		// Reconcile unschedules MetricWebhooks updated to an invalid spec
+		return nil
+	}
+	if metricWebhook.Spec.Mode == metricsv1alpha1.SuspendedMode {
+		// Reconcile unschedules suspended MetricWebhooks
+		return nil
+	}
+
+	// Write the metrics and conditions of this scrape, and the reports it
+	// recorded in DryRun mode, leaving the rest of the status as is
+	var dryRunReports []metricsv1alpha1.DryRunReport
 	defer func() {
-		err = r.client.Status().Update(context.TODO(), metricWebhook)
+		err := r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+			latest.Status.Metrics = metricWebhook.Status.Metrics
+			copyConditions(&metricWebhook.Status, &latest.Status, scrapeConditions...)
+			setReadyCondition(latest)
+			if latest.Spec.Mode == metricsv1alpha1.DryRunMode {
+				appendDryRunReports(&latest.Status, dryRunReports...)
+			} else {
+				latest.Status.DryRunReports = nil
+			}
+		})
 		if err != nil {
 			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSaveStatus", err.Error())
 			reqLogger.Error(err, "failed to update MetricWebhook status")
@@ -86,77 +209,232 @@ func (r *MetricWebhookReconciler) Reconcile(request reconcile.Request) (reconcil
 	}()
 
 	// Fetch metric values and update MetricWebhook instance status
-	currMetrics, err := r.fetchCurrentMetrics(metricWebhook.Spec.Metrics, metricWebhook.Namespace, metricWebhook.Spec.Selector)
-	if err != nil {
-		r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedFetchMetrics", err.Error())
-		reqLogger.Error(err, "failed to fetch current metric values",
+	prevMetrics := metricWebhook.Status.DeepCopy().Metrics
+	currMetrics, fetchErrs := r.fetchCurrentMetrics(metricWebhook.Spec.Metrics, prevMetrics, metricWebhook.Namespace, metricWebhook.Spec.Selector)
+	if len(fetchErrs) > 0 {
+		fetchErr := utilerrors.NewAggregate(fetchErrs)
+		r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedFetchMetrics", fetchErr.Error())
+		setCondition(metricWebhook, metricsv1alpha1.MetricsAvailableCondition, v1.ConditionFalse, ReasonFetchFailed,
+			fmt.Sprintf("%d of %d metric(s) failed: %v", len(fetchErrs), len(currMetrics), fetchErr))
+		reqLogger.Error(fetchErr, "failed to fetch current metric values",
 			"Spec.Selector", metricWebhook.Spec.Selector,
 		)
-		return reconcile.Result{}, err
-	}
-	prevMetrics := metricWebhook.Status.DeepCopy().Metrics
-	if currMetrics != nil {
-		metricWebhook.Status.Metrics = currMetrics
+	} else {
+		setCondition(metricWebhook, metricsv1alpha1.MetricsAvailableCondition, v1.ConditionTrue, ReasonMetricsFetched, "")
 	}
+	metricWebhook.Status.Metrics = currMetrics
+	setAlertingCondition(metricWebhook)
+	observeMetricStatuses(name, metricWebhook.Status.Metrics)
 
 	// Diff and group metric to improved and unimproved metrics
 	improvedMetrics, alertingMetrics := r.findImprovedAndAlertingMetrics(prevMetrics, currMetrics)
 
+	// Report metrics failed to be fetched as the failure policy defines, and
+	// the ones failing or keeping the same sample for too long as blind
+	staleAfter := metricWebhook.Spec.StaleAfter.Duration
+	var noDataMetrics, staleMetrics []metricsv1alpha1.MetricStatus
+	for _, metric := range currMetrics {
+		switch {
+		case metric.Error == "":
+			if time.Since(metric.ScrapeTime.Time) > staleAfter {
+				staleMetrics = append(staleMetrics, metric)
+			}
+		case metricWebhook.Spec.FailurePolicy == metricsv1alpha1.NoDataFailurePolicy ||
+			time.Since(lastSuccessfulScrape(metricWebhook, metric)) > staleAfter:
+			noDataMetrics = append(noDataMetrics, metric)
+		case metricWebhook.Spec.FailurePolicy == metricsv1alpha1.KeepLastFailurePolicy:
+			alertingMetrics = append(alertingMetrics, metric)
+		}
+	}
+	if len(fetchErrs) == 0 && len(staleMetrics) > 0 {
+		setCondition(metricWebhook, metricsv1alpha1.MetricsAvailableCondition, v1.ConditionFalse, ReasonMetricsStale,
+			fmt.Sprintf("%d of %d metric(s) kept the same sample for longer than %v", len(staleMetrics), len(currMetrics), staleAfter))
+	}
+
 	// Compile metric report to (not/)include cooldown notifications
 	var metricReport metricsv1alpha1.MetricReport
 	if metricWebhook.Spec.CooldownAlert {
-		metricReport = r.createMetricReport(alertingMetrics, improvedMetrics)
+		metricReport = r.createMetricReport(alertingMetrics, improvedMetrics, noDataMetrics, staleMetrics)
 	} else {
-		metricReport = r.createMetricReport(alertingMetrics, []metricsv1alpha1.MetricStatus{})
+		metricReport = r.createMetricReport(alertingMetrics, []metricsv1alpha1.MetricStatus{}, noDataMetrics, staleMetrics)
 	}
 
 	// Post event(s) describing the metric notifications to be sent
 	r.postMetricReportEvents(metricWebhook, metricReport)
 
+	// Resolve webhook urls on every scrape to keep TargetsResolved up to date
+	// even while there is nothing to report
+	webhookUrls, resolveErr := r.compileWebhookUrl(metricWebhook.Spec.Webhook, metricWebhook.Namespace, metricWebhook.Spec.Selector)
+	switch {
+	case resolveErr != nil:
+		setCondition(metricWebhook, metricsv1alpha1.TargetsResolvedCondition, v1.ConditionFalse, ReasonResolveFailed, resolveErr.Error())
+	case len(webhookUrls) == 0:
+		setCondition(metricWebhook, metricsv1alpha1.TargetsResolvedCondition, v1.ConditionFalse, ReasonNoTargets,
+			"no pods match the selector")
+	default:
+		setCondition(metricWebhook, metricsv1alpha1.TargetsResolvedCondition, v1.ConditionTrue, ReasonTargetsResolved,
+			fmt.Sprintf("%d webhook target(s) resolved", len(webhookUrls)))
+	}
+	if resolveErr == nil {
+		r.targets.update(name, webhookUrls)
+	}
+
+	// Record rather than send out metric notifications in DryRun mode,
+	// deliveries of the Active mode no longer tell the MetricWebhook state
+	if metricWebhook.Spec.Mode == metricsv1alpha1.DryRunMode {
+		metricWebhook.Status.RemoveCondition(metricsv1alpha1.WebhookDeliveringCondition)
+		if len(metricReport) > 0 {
+			if dryRunReport := r.recordDryRun(metricWebhook, metricReport, webhookUrls, resolveErr); dryRunReport != nil {
+				dryRunReports = append(dryRunReports, *dryRunReport)
+			}
+		}
+		return nil
+	}
+	metricWebhook.Status.DryRunReports = nil
+
 	// Send out metric notifications
 	if len(metricReport) > 0 {
-		webhookUrls, err := r.compileWebhookUrl(metricWebhook.Spec.Webhook, metricWebhook.Namespace, metricWebhook.Spec.Selector)
-		if err != nil {
-			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSendReport", err.Error())
-			reqLogger.Error(err, "failed to resolve webhook url")
-			return reconcile.Result{}, err
+		r.reportBroker.Publish(name, metricReport)
+
+		if resolveErr != nil {
+			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSendReport", resolveErr.Error())
+			setCondition(metricWebhook, metricsv1alpha1.WebhookDeliveringCondition, v1.ConditionFalse, ReasonResolveFailed, resolveErr.Error())
+			reqLogger.Error(resolveErr, "failed to resolve webhook url")
+			return resolveErr
 		}
-		for _, webhookUrl := range webhookUrls {
-			reqLogger.Info("notifying webhook",
-				"Spec.Webhook.Url(resolved)", webhookUrl,
-				"metricReport", metricReport,
-			)
-			err = r.metricNotificationClient.notify(webhookUrl, metricReport)
-			if err != nil {
-				r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSendReport", err.Error())
+		reqLogger.Info("notifying webhook",
+			"Spec.Webhook.Url(resolved)", webhookUrls,
+			"metricReport", metricReport,
+		)
+		deliveryCtx, cancel := deliveryContext(ctx, metricWebhook.Spec.ScrapeInterval.Duration)
+		defer cancel()
+
+		var lastErr error
+		failed := 0
+		endpoint := webhookEndpoint(metricWebhook.Spec)
+		for _, result := range r.metricNotificationClient.notifyAll(deliveryCtx, name, endpoint, webhookUrls, metricReport) {
+			if result.err != nil {
+				r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedSendReport", result.err.Error())
 				reqLogger.Info("failed to notify webhook",
-					"Spec.Webhook.Url(resolved)", webhookUrl,
-					"Error", err,
+					"Spec.Webhook.Url(resolved)", result.webhookUrl,
+					"StatusCode", result.statusCode,
+					"Error", result.err,
 				)
+				lastErr = result.err
+				failed++
 				// Stay resilient, proceed normally
+			} else {
+				observeNotificationsSent(name, metricReport)
+				if result.statusCode == http.StatusAccepted {
+					reqLogger.Info("webhook accepted report for later processing",
+						"Spec.Webhook.Url(resolved)", result.webhookUrl,
+					)
+				}
 			}
 		}
+		if ctx.Err() != nil {
+			// Unscheduled or rescheduled meanwhile, the targets have not failed
+			reqLogger.Info("delivery cancelled", "Error", ctx.Err())
+		} else if failed > 0 {
+			setCondition(metricWebhook, metricsv1alpha1.WebhookDeliveringCondition, v1.ConditionFalse, ReasonDeliveryFailed,
+				fmt.Sprintf("%d of %d webhook target(s) failed: %v", failed, len(webhookUrls), lastErr))
+		} else if len(webhookUrls) > 0 {
+			setCondition(metricWebhook, metricsv1alpha1.WebhookDeliveringCondition, v1.ConditionTrue, ReasonReportDelivered,
+				fmt.Sprintf("report delivered to %d webhook target(s)", len(webhookUrls)))
+		}
 	}
 
-	return reconcile.Result{
-		Requeue:      true,
-		RequeueAfter: metricWebhook.Spec.ScrapeInterval.Duration,
-	}, nil
+	return nil
+}
+
+// patchStatus applies update to the status of the latest version of the
+// MetricWebhook read from the API server rather than the cache, and merge-patches
+// the result. The patch carries the resourceVersion read, so that the API server
+// rejects it if the MetricWebhook has been changed meanwhile, in which case
+// update is applied again to the newer version. The status is left as is if
+// the spec has changed since metricWebhook has been read, the status of the
+// newer spec is written by the reconcile and scrapes it triggers.
+func (r *MetricWebhookReconciler) patchStatus(metricWebhook *metricsv1alpha1.MetricWebhook, update func(latest *metricsv1alpha1.MetricWebhook)) error {
+	name := types.NamespacedName{Namespace: metricWebhook.Namespace, Name: metricWebhook.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &metricsv1alpha1.MetricWebhook{}
+		if err := r.apiReader.Get(context.TODO(), name, latest); err != nil {
+			return err
+		}
+		if latest.Generation != metricWebhook.Generation {
+			return nil
+		}
+
+		original := latest.DeepCopy()
+		update(latest)
+		// Merge patches carry the resourceVersion only if it differs from the original's
+		original.ResourceVersion = ""
+		return r.client.Status().Patch(context.TODO(), latest, client.MergeFrom(original))
+	})
 }
 
-func (r *MetricWebhookReconciler) fetchCurrentMetrics(metricSpecs []metricsv1alpha1.MetricSpec, namespace string, labelSelector metav1.LabelSelector) ([]metricsv1alpha1.MetricStatus, error) {
+// fetchCurrentMetrics fetches each of the metrics independently, a metric
+// failed to be fetched keeps its previous values, if any, along with the error
+func (r *MetricWebhookReconciler) fetchCurrentMetrics(metricSpecs []metricsv1alpha1.MetricSpec, prevMetrics []metricsv1alpha1.MetricStatus, namespace string, labelSelector metav1.LabelSelector) ([]metricsv1alpha1.MetricStatus, []error) {
+	metricNameToPrev := make(map[string]metricsv1alpha1.MetricStatus)
+	for _, metric := range prevMetrics {
+		metricNameToPrev[metric.MetricName()] = metric
+	}
+
 	var metricStatuses []metricsv1alpha1.MetricStatus
+	var errs []error
 	for _, metricSpec := range metricSpecs {
 		metricStatus, err := r.fetchCurrentMetric(metricSpec, namespace, labelSelector)
 		if err != nil {
-			return metricStatuses, err
+			errs = append(errs, fmt.Errorf("%s: %v", metricSpec.MetricName(), err))
+			metricStatus = failedMetricStatus(metricSpec, metricNameToPrev, err)
+		} else {
+			lastSuccessfulScrape := metav1.Now()
+			metricStatus.LastSuccessfulScrape = &lastSuccessfulScrape
 		}
 		metricStatuses = append(metricStatuses, metricStatus)
 	}
-	return metricStatuses, nil
+	return metricStatuses, errs
 }
 
-func (r *MetricWebhookReconciler) fetchCurrentMetric(spec metricsv1alpha1.MetricSpec, namespace string, labelSelector metav1.LabelSelector) (metricsv1alpha1.MetricStatus, error) {
+// lastSuccessfulScrape is the last time the metric has been fetched, or the
+// creation time of the MetricWebhook if it has never been fetched
+func lastSuccessfulScrape(metricWebhook *metricsv1alpha1.MetricWebhook, metric metricsv1alpha1.MetricStatus) time.Time {
+	if metric.LastSuccessfulScrape != nil {
+		return metric.LastSuccessfulScrape.Time
+	}
+	return metricWebhook.CreationTimestamp.Time
+}
+
+// failedMetricStatus is the previous status of the metric, or the one with
+// targets only if the metric has never been fetched, flagged with the error
+func failedMetricStatus(spec metricsv1alpha1.MetricSpec, metricNameToPrev map[string]metricsv1alpha1.MetricStatus, err error) metricsv1alpha1.MetricStatus {
+	metricStatus, fetchedBefore := metricNameToPrev[spec.MetricName()]
+	if fetchedBefore && metricStatus.Type == spec.Type {
+		metricStatus = *metricStatus.DeepCopy()
+	} else {
+		metricStatus = metricsv1alpha1.MetricStatus{Type: spec.Type}
+		switch spec.Type {
+		case metricsv1alpha1.PodsMetricSourceType:
+			metricStatus.Pods = &metricsv1alpha1.PodsMetricStatus{
+				Name:               spec.Pods.Name,
+				TargetAverageValue: spec.Pods.TargetAverageValue,
+			}
+		case metricsv1alpha1.ResourceMetricSourceType:
+			metricStatus.Resource = &metricsv1alpha1.ResourceMetricStatus{
+				Name:                     spec.Resource.Name,
+				TargetAverageUtilization: spec.Resource.TargetAverageUtilization,
+				TargetAverageValue:       spec.Resource.TargetAverageValue,
+			}
+		}
+	}
+	metricStatus.Error = err.Error()
+	return metricStatus
+}
+
+func (r *MetricWebhookReconciler) fetchCurrentMetric(spec metricsv1alpha1.MetricSpec, namespace string, labelSelector metav1.LabelSelector) (status metricsv1alpha1.MetricStatus, err error) {
+	start := time.Now()
+	defer func() { observeFetch(spec.Type, start, err) }()
 	switch spec.Type {
 	case metricsv1alpha1.PodsMetricSourceType:
 		currPodMetric, exceedsThreshold, timestamp, err := r.fetchCurrentPodMetric(spec.Pods, namespace, labelSelector)
@@ -256,7 +534,11 @@ func (r *MetricWebhookReconciler) findImprovedAndAlertingMetrics(orig []metricsv
 	}
 
 	for name, origMetric := range metricNameToOrigin {
-		updMetric := metricNameToUpdated[name]
+		updMetric, found := metricNameToUpdated[name]
+		if !found || updMetric.Error != "" {
+			// Metrics removed from the spec or failed to be fetched
+			continue
+		}
 
 		if origMetric.ScrapeTime.Equal(&updMetric.ScrapeTime) {
 			// New metric values have not arrived yet
@@ -273,16 +555,22 @@ func (r *MetricWebhookReconciler) findImprovedAndAlertingMetrics(orig []metricsv
 	return
 }
 
-func (r *MetricWebhookReconciler) createMetricReport(alertingMetrics, improvedMetrics []metricsv1alpha1.MetricStatus) metricsv1alpha1.MetricReport {
+func (r *MetricWebhookReconciler) createMetricReport(alertingMetrics, improvedMetrics, noDataMetrics, staleMetrics []metricsv1alpha1.MetricStatus) metricsv1alpha1.MetricReport {
 	var report metricsv1alpha1.MetricReport
 	for _, metric := range alertingMetrics {
 		if !metric.Alerting {
 			continue
 		}
-		report = append(report, createMetricNotification(metricsv1alpha1.Alert, metric))
+		report = append(report, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Alert, metric))
 	}
 	for _, metric := range improvedMetrics {
-		report = append(report, createMetricNotification(metricsv1alpha1.Cooldown, metric))
+		report = append(report, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Cooldown, metric))
+	}
+	for _, metric := range noDataMetrics {
+		report = append(report, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.NoData, metric))
+	}
+	for _, metric := range staleMetrics {
+		report = append(report, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Stale, metric))
 	}
 
 	return report
@@ -340,6 +628,10 @@ func (r *MetricWebhookReconciler) compileWebhookUrl(spec metricsv1alpha1.Webhook
 
 		var webhookUrls []string
 		for _, pod := range pods.Items {
+			if pod.Status.PodIP == "" || !isPodReady(&pod) || pod.DeletionTimestamp != nil {
+				// Not started yet, not ready to serve or terminating
+				continue
+			}
 			webhookUrl := fmt.Sprintf("http://%s:%d",
 				pod.Status.PodIP, spec.Port)
 			if webhookPath := spec.Path; webhookPath != "" {
@@ -355,12 +647,18 @@ func (r *MetricWebhookReconciler) compileWebhookUrl(spec metricsv1alpha1.Webhook
 func (r *MetricWebhookReconciler) postMetricReportEvents(o runtime.Object, report metricsv1alpha1.MetricReport) {
 	var alertingMetrics []string
 	var cooldownMetric []string
+	var noDataMetrics []string
+	var staleMetrics []string
 	for _, notification := range report {
 		switch notification.Type {
 		case metricsv1alpha1.Alert:
 			alertingMetrics = append(alertingMetrics, notification.String())
 		case metricsv1alpha1.Cooldown:
 			cooldownMetric = append(cooldownMetric, notification.String())
+		case metricsv1alpha1.NoData:
+			noDataMetrics = append(noDataMetrics, notification.Name)
+		case metricsv1alpha1.Stale:
+			staleMetrics = append(staleMetrics, notification.Name)
 		}
 	}
 
@@ -372,37 +670,10 @@ func (r *MetricWebhookReconciler) postMetricReportEvents(o runtime.Object, repor
 		cooldownMetricStatus := strings.Join(cooldownMetric, ", ")
 		r.eventRecorder.Event(o, v1.EventTypeNormal, "NewCooldowns", cooldownMetricStatus)
 	}
-}
-
-func createMetricNotification(typ metricsv1alpha1.MetricNotificationType, metric metricsv1alpha1.MetricStatus) metricsv1alpha1.MetricNotification {
-	switch metric.Type {
-	case metricsv1alpha1.PodsMetricSourceType:
-		return metricsv1alpha1.MetricNotification{
-			Type: typ,
-
-			MetricType: metric.Type,
-			Name:       metric.Pods.Name,
-
-			CurrentAverageValue: metric.Pods.CurrentAverageValue,
-			TargetAverageValue:  &metric.Pods.TargetAverageValue,
-
-			ScrapeTime: metric.ScrapeTime.Time,
-		}
-	case metricsv1alpha1.ResourceMetricSourceType:
-		return metricsv1alpha1.MetricNotification{
-			Type: typ,
-
-			MetricType: metric.Type,
-			Name:       metric.Resource.Name.String(),
-
-			CurrentAverageValue: metric.Resource.CurrentAverageValue,
-			TargetAverageValue:  metric.Resource.TargetAverageValue,
-
-			CurrentAverageUtilization: metric.Resource.CurrentAverageUtilization,
-			TargetAverageUtilization:  metric.Resource.TargetAverageUtilization,
-
-			ScrapeTime: metric.ScrapeTime.Time,
-		}
+	if len(noDataMetrics) > 0 {
+		r.eventRecorder.Event(o, v1.EventTypeWarning, "NoData", strings.Join(noDataMetrics, ", "))
+	}
+	if len(staleMetrics) > 0 {
+		r.eventRecorder.Event(o, v1.EventTypeWarning, "Stale", strings.Join(staleMetrics, ", "))
 	}
-	return metricsv1alpha1.MetricNotification{}
 }
@@ -0,0 +1,171 @@
+package metricwebhook
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const SchedulerName = "metricwebhook-scheduler"
+
+// DefaultScrapeJitter is the fraction of the scrape interval the first scrape
+// of a MetricWebhook is randomly delayed by, spreading scrapes of MetricWebhooks
+// created at once (e.g. on operator start) over time
+const DefaultScrapeJitter = 0.1
+
+// ScrapeFunc scrapes metrics of a MetricWebhook and notifies its webhook,
+// giving up the notification once ctx is done
+type ScrapeFunc func(ctx context.Context, name types.NamespacedName) error
+
+// Scheduler owns a ticker per MetricWebhook so that metrics are scraped at
+// evenly spaced intervals regardless of reconcile retries and backoffs.
+// Scrapes of a single MetricWebhook never overlap, ticks missed while a scrape
+// is running are dropped.
+type Scheduler struct {
+	scrape ScrapeFunc
+	jitter float64
+	logger logr.Logger
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	schedules map[types.NamespacedName]*schedule
+	wg        sync.WaitGroup
+}
+
+type schedule struct {
+	interval time.Duration
+	// cancel stops the ticker and cancels the scrape running, if any,
+	// done is closed once that scrape has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewScheduler(scrape ScrapeFunc, jitter float64) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		scrape:    scrape,
+		jitter:    jitter,
+		logger:    logf.Log.WithName(SchedulerName),
+		ctx:       ctx,
+		cancel:    cancel,
+		schedules: make(map[types.NamespacedName]*schedule),
+	}
+}
+
+// Schedule starts scraping the MetricWebhook every interval, restarting its
+// ticker only if the interval has changed. The ticker replaced is stopped and
+// its running scrape cancelled and waited for, so that scrapes do not overlap
+// while the caller is not held up by deliveries to unreachable targets.
+func (s *Scheduler) Schedule(name types.NamespacedName, interval time.Duration) {
+	for {
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			s.mu.Unlock()
+			return
+		}
+		current, scheduled := s.schedules[name]
+		if !scheduled {
+			break
+		}
+		if current.interval == interval {
+			s.mu.Unlock()
+			return
+		}
+		current.cancel()
+		delete(s.schedules, name)
+		s.mu.Unlock()
+
+		// Not holding the lock while waiting, scrapes of other MetricWebhooks go on
+		<-current.done
+	}
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	current := &schedule{interval: interval, cancel: cancel, done: make(chan struct{})}
+	s.schedules[name] = current
+	s.wg.Add(1)
+	go s.run(ctx, name, interval, current.done)
+
+	s.logger.Info("scheduled scraping", "Resource", name, "Interval", interval)
+}
+
+// Unschedule stops scraping the MetricWebhook, e.g. once it has been deleted,
+// cancels its running scrape and waits for it to return
+func (s *Scheduler) Unschedule(name types.NamespacedName) {
+	s.mu.Lock()
+	current, scheduled := s.schedules[name]
+	if scheduled {
+		current.cancel()
+		delete(s.schedules, name)
+		s.logger.Info("unscheduled scraping", "Resource", name)
+	}
+	s.mu.Unlock()
+
+	if scheduled {
+		<-current.done
+	}
+}
+
+// Go runs fn once in the background, e.g. a delivery that should not hold up
+// the reconcile triggering it. Start waits for it to return on shutdown.
+func (s *Scheduler) Go(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// Start implements manager.Runnable, it blocks until stop is closed and then
+// stops all tickers, cancels the running scrapes and waits for those and the
+// jobs to finish
+func (s *Scheduler) Start(stop <-chan struct{}) error {
+	<-stop
+
+	s.mu.Lock()
+	s.cancel()
+	s.schedules = make(map[types.NamespacedName]*schedule)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) run(ctx context.Context, name types.NamespacedName, interval time.Duration, done chan<- struct{}) {
+	defer s.wg.Done()
+	defer close(done)
+
+	delay := time.Duration(rand.Float64() * s.jitter * float64(interval))
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.scrape(ctx, name); err != nil {
+			s.logger.Error(err, "failed to scrape metrics", "Resource", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
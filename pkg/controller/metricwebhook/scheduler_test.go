@@ -0,0 +1,234 @@
+package metricwebhook
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeScrape counts scrapes per MetricWebhook and tracks how many run at once,
+// blocking each scrape until release is closed, if set, or it is cancelled
+type fakeScrape struct {
+	mu         sync.Mutex
+	scrapes    map[types.NamespacedName]int
+	running    int
+	maxRunning int
+	cancelled  int
+	started    chan types.NamespacedName
+	release    chan struct{}
+}
+
+func newFakeScrape(blocking bool) *fakeScrape {
+	f := &fakeScrape{
+		scrapes: make(map[types.NamespacedName]int),
+		started: make(chan types.NamespacedName, 100),
+	}
+	if blocking {
+		f.release = make(chan struct{})
+	}
+	return f
+}
+
+func (f *fakeScrape) scrape(ctx context.Context, name types.NamespacedName) error {
+	f.mu.Lock()
+	f.scrapes[name]++
+	f.running++
+	if f.running > f.maxRunning {
+		f.maxRunning = f.running
+	}
+	f.mu.Unlock()
+
+	f.started <- name
+	cancelled := false
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			cancelled = true
+		}
+	}
+
+	f.mu.Lock()
+	f.running--
+	if cancelled {
+		f.cancelled++
+	}
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeScrape) count(name types.NamespacedName) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scrapes[name]
+}
+
+func awaitScrape(t *testing.T, f *fakeScrape) types.NamespacedName {
+	t.Helper()
+	select {
+	case name := <-f.started:
+		return name
+	case <-time.After(time.Second):
+		t.Fatal("no scrape started")
+		return types.NamespacedName{}
+	}
+}
+
+func stopScheduler(t *testing.T, s *Scheduler) {
+	t.Helper()
+	stop := make(chan struct{})
+	close(stop)
+	assert.NoError(t, s.Start(stop))
+}
+
+var testWebhook = types.NamespacedName{Namespace: "default", Name: "app"}
+
+func TestScheduler_Cadence(t *testing.T) {
+	f := newFakeScrape(false)
+	s := NewScheduler(f.scrape, 0)
+	defer stopScheduler(t, s)
+
+	s.Schedule(testWebhook, 20*time.Millisecond)
+	time.Sleep(110 * time.Millisecond)
+
+	// The first scrape runs right away, then one per tick
+	count := f.count(testWebhook)
+	assert.True(t, count >= 4 && count <= 7, "scrapes = %d", count)
+}
+
+func TestScheduler_UnchangedIntervalKeepsTicker(t *testing.T) {
+	f := newFakeScrape(false)
+	s := NewScheduler(f.scrape, 0)
+	defer stopScheduler(t, s)
+
+	s.Schedule(testWebhook, time.Hour)
+	awaitScrape(t, f)
+	s.Schedule(testWebhook, time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	// A restarted ticker would have scraped right away again
+	assert.Equal(t, 1, f.count(testWebhook))
+}
+
+func TestScheduler_IntervalChangeCancelsRunningScrape(t *testing.T) {
+	f := newFakeScrape(true)
+	s := NewScheduler(f.scrape, 0)
+	defer stopScheduler(t, s)
+
+	s.Schedule(testWebhook, time.Hour)
+	awaitScrape(t, f)
+
+	// The scrape blocked on delivery is cancelled rather than waited for
+	rescheduled := make(chan struct{})
+	go func() {
+		s.Schedule(testWebhook, time.Minute)
+		close(rescheduled)
+	}()
+	select {
+	case <-rescheduled:
+	case <-time.After(time.Second):
+		t.Fatal("rescheduling held up by the running scrape")
+	}
+	awaitScrape(t, f)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Equal(t, 2, f.scrapes[testWebhook])
+	assert.Equal(t, 1, f.cancelled)
+	assert.Equal(t, 1, f.maxRunning)
+}
+
+func TestScheduler_Unschedule(t *testing.T) {
+	f := newFakeScrape(false)
+	s := NewScheduler(f.scrape, 0)
+	defer stopScheduler(t, s)
+
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	s.Schedule(testWebhook, 10*time.Millisecond)
+	s.Schedule(other, 10*time.Millisecond)
+	awaitScrape(t, f)
+	awaitScrape(t, f)
+
+	s.Unschedule(testWebhook)
+	count := f.count(testWebhook)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, count, f.count(testWebhook))
+	assert.True(t, f.count(other) > 1)
+}
+
+func TestScheduler_UnscheduleCancelsRunningScrape(t *testing.T) {
+	f := newFakeScrape(true)
+	s := NewScheduler(f.scrape, 0)
+	defer stopScheduler(t, s)
+
+	s.Schedule(testWebhook, time.Hour)
+	awaitScrape(t, f)
+
+	unscheduled := make(chan struct{})
+	go func() {
+		s.Unschedule(testWebhook)
+		close(unscheduled)
+	}()
+	select {
+	case <-unscheduled:
+	case <-time.After(time.Second):
+		t.Fatal("unscheduling held up by the running scrape")
+	}
+
+	// The scrape has returned once Unschedule does
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Equal(t, 0, f.running)
+	assert.Equal(t, 1, f.cancelled)
+}
+
+func TestScheduler_StartDrainsOnStop(t *testing.T) {
+	f := newFakeScrape(true)
+	s := NewScheduler(f.scrape, 0)
+
+	s.Schedule(testWebhook, time.Hour)
+	awaitScrape(t, f)
+	jobDone := make(chan struct{})
+	s.Go(func() {
+		<-f.release
+		close(jobDone)
+	})
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		assert.NoError(t, s.Start(stop))
+		close(stopped)
+	}()
+	close(stop)
+	select {
+	case <-stopped:
+		t.Fatal("stopped while a job is running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(f.release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("not stopped once the job has returned")
+	}
+	<-jobDone
+	f.mu.Lock()
+	assert.Equal(t, 1, f.cancelled, "running scrape cancelled on stop")
+	f.mu.Unlock()
+
+	// Nothing is scheduled or run once stopped
+	s.Schedule(testWebhook, time.Millisecond)
+	ran := false
+	s.Go(func() { ran = true })
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, f.count(testWebhook))
+	assert.False(t, ran)
+}
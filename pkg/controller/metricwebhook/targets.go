@@ -0,0 +1,172 @@
+package metricwebhook
+
+import (
+	"context"
+	"sync"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// targetSet tracks the webhook urls resolved per MetricWebhook so that
+// targets appeared since the last resolution can be told apart
+type targetSet struct {
+	mu      sync.Mutex
+	targets map[types.NamespacedName]map[string]bool
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{targets: make(map[types.NamespacedName]map[string]bool)}
+}
+
+// update replaces the targets of the MetricWebhook, returning the ones not known before
+func (t *targetSet) update(name types.NamespacedName, webhookUrls []string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known := t.targets[name]
+	targets := make(map[string]bool, len(webhookUrls))
+	var added []string
+	for _, webhookUrl := range webhookUrls {
+		targets[webhookUrl] = true
+		if !known[webhookUrl] {
+			added = append(added, webhookUrl)
+		}
+	}
+	t.targets[name] = targets
+	return added
+}
+
+func (t *targetSet) forget(name types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.targets, name)
+}
+
+// catchUp resolves the webhook targets of the MetricWebhook and sends the
+// current alert state to the ones appeared since the last resolution, so that
+// e.g. newly started pods do not wait for the next scrape to degrade. The
+// state is delivered in the background as unreachable targets would hold up
+// reconciles for as long as the delivery retries take.
+func (r *MetricWebhookReconciler) catchUp(metricWebhook *metricsv1alpha1.MetricWebhook) {
+	name := types.NamespacedName{Namespace: metricWebhook.Namespace, Name: metricWebhook.Name}
+	reqLogger := r.logger.WithValues("Resource", name)
+	if !metricWebhook.Status.Mode.IsActive() {
+		// Nothing has been delivered to the known targets either
+		return
+	}
+
+	webhookUrls, err := r.compileWebhookUrl(metricWebhook.Spec.Webhook, metricWebhook.Namespace, metricWebhook.Spec.Selector)
+	if err != nil {
+		// The next scrape reports the failure
+		reqLogger.Info("failed to resolve webhook url", "Error", err)
+		return
+	}
+	addedUrls := r.targets.update(name, webhookUrls)
+
+	var alertState metricsv1alpha1.MetricReport
+	for _, metric := range metricWebhook.Status.Metrics {
+		if metric.Alerting && metric.Error == "" {
+			alertState = append(alertState, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Alert, metric))
+		}
+	}
+	if len(alertState) == 0 {
+		return
+	}
+
+	if len(addedUrls) == 0 {
+		return
+	}
+
+	scrapeInterval := metricWebhook.Spec.ScrapeInterval.Duration
+	endpoint := webhookEndpoint(metricWebhook.Spec)
+	r.scheduler.Go(func() {
+		reqLogger.Info("catching up new webhook targets",
+			"Spec.Webhook.Url(resolved)", addedUrls,
+			"metricReport", alertState,
+		)
+		ctx, cancel := deliveryContext(context.Background(), scrapeInterval)
+		defer cancel()
+		for _, result := range r.metricNotificationClient.notifyAll(ctx, name, endpoint, addedUrls, alertState) {
+			if result.err != nil {
+				reqLogger.Info("failed to catch up new webhook target",
+					"Spec.Webhook.Url(resolved)", result.webhookUrl,
+					"Error", result.err,
+				)
+				continue
+			}
+			observeNotificationsSent(name, alertState)
+		}
+	})
+}
+
+// webhooksTargeting maps changes of pods to the MetricWebhooks those may be
+// webhook targets of
+type webhooksTargeting struct {
+	client client.Client
+}
+
+// pods maps a pod to the MetricWebhooks selecting it, unless they target a service or url
+func (m *webhooksTargeting) pods(object handler.MapObject) []reconcile.Request {
+	return m.requests(object.Meta.GetNamespace(), func(metricWebhook *metricsv1alpha1.MetricWebhook) bool {
+		if metricWebhook.Spec.Webhook.Url != "" || metricWebhook.Spec.Webhook.Service != "" {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&metricWebhook.Spec.Selector)
+		return err == nil && selector.Matches(labels.Set(object.Meta.GetLabels()))
+	})
+}
+
+func (m *webhooksTargeting) requests(namespace string, targets func(*metricsv1alpha1.MetricWebhook) bool) []reconcile.Request {
+	var metricWebhooks metricsv1alpha1.MetricWebhookList
+	if err := m.client.List(context.TODO(), &metricWebhooks, client.InNamespace(namespace)); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range metricWebhooks.Items {
+		if targets(&metricWebhooks.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: metricWebhooks.Items[i].Namespace,
+				Name:      metricWebhooks.Items[i].Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// podTargetChangedPredicate passes pod events that may change webhook
+// targets, that is pods becoming ready or unready and pods changing their IPs
+type podTargetChangedPredicate struct {
+	predicate.Funcs
+}
+
+func (podTargetChangedPredicate) Update(e event.UpdateEvent) bool {
+	oldPod, oldIsPod := e.ObjectOld.(*v1.Pod)
+	newPod, newIsPod := e.ObjectNew.(*v1.Pod)
+	if !oldIsPod || !newIsPod {
+		return false
+	}
+	return oldPod.Status.PodIP != newPod.Status.PodIP || isPodReady(oldPod) != isPodReady(newPod)
+}
+
+// isPodReady tells whether the pod has passed its readiness probes, that is
+// whether its webhook server can be expected to listen already
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
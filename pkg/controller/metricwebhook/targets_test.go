@@ -0,0 +1,93 @@
+package metricwebhook
+
+import (
+	"testing"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func testPod(name, ip string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "app"}},
+		Status: v1.PodStatus{
+			PodIP:      ip,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestPodTargetChangedPredicate(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new *v1.Pod
+		passes   bool
+	}{
+		{
+			name:   "ip assigned before ready",
+			old:    testPod("app", "", false),
+			new:    testPod("app", "10.0.0.1", false),
+			passes: true,
+		},
+		{
+			name:   "becomes ready",
+			old:    testPod("app", "10.0.0.1", false),
+			new:    testPod("app", "10.0.0.1", true),
+			passes: true,
+		},
+		{
+			name:   "becomes unready",
+			old:    testPod("app", "10.0.0.1", true),
+			new:    testPod("app", "10.0.0.1", false),
+			passes: true,
+		},
+		{
+			name: "unchanged",
+			old:  testPod("app", "10.0.0.1", true),
+			new:  testPod("app", "10.0.0.1", true),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := event.UpdateEvent{ObjectOld: test.old, ObjectNew: test.new}
+			assert.Equal(t, test.passes, podTargetChangedPredicate{}.Update(e))
+		})
+	}
+}
+
+func TestCompileWebhookUrl_SkipsUnreadyPods(t *testing.T) {
+	r := &MetricWebhookReconciler{client: fake.NewFakeClientWithScheme(scheme.Scheme,
+		testPod("ready", "10.0.0.1", true),
+		testPod("unready", "10.0.0.2", false),
+		testPod("pending", "", false),
+	)}
+	spec := metricsv1alpha1.Webhook{Port: 4030, Path: "/metrics-webhook"}
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}}
+
+	webhookUrls, err := r.compileWebhookUrl(spec, "default", selector)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:4030/metrics-webhook"}, webhookUrls)
+
+	// The pod is caught up once it becomes ready, not when it gets its IP
+	targets := newTargetSet()
+	assert.Equal(t, webhookUrls, targets.update(testWebhook, webhookUrls))
+	r.client = fake.NewFakeClientWithScheme(scheme.Scheme,
+		testPod("ready", "10.0.0.1", true),
+		testPod("unready", "10.0.0.2", true),
+	)
+	webhookUrls, err = r.compileWebhookUrl(spec, "default", selector)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.2:4030/metrics-webhook"}, targets.update(testWebhook, webhookUrls))
+}
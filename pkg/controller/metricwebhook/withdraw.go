@@ -0,0 +1,223 @@
+package metricwebhook
+
+import (
+	"context"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// withdraw sends Withdrawn notifications for the given metrics to all of the
+// webhook targets of the MetricWebhook, it is best effort since no further
+// attempts are possible once the metrics are gone. If the status has been
+// reported in DryRun mode, nothing has been delivered and the notifications
+// are recorded instead, returning the report recorded.
+func (r *MetricWebhookReconciler) withdraw(metricWebhook *metricsv1alpha1.MetricWebhook, metrics []metricsv1alpha1.MetricStatus) *metricsv1alpha1.DryRunReport {
+	name := types.NamespacedName{Namespace: metricWebhook.Namespace, Name: metricWebhook.Name}
+	reqLogger := r.logger.WithValues("Resource", name)
+
+	var metricReport metricsv1alpha1.MetricReport
+	for _, metric := range metrics {
+		if metric.Alerting {
+			metricReport = append(metricReport, metricsv1alpha1.NewMetricNotification(metricsv1alpha1.Withdrawn, metric))
+		}
+	}
+	if len(metricReport) == 0 {
+		return nil
+	}
+
+	webhookUrls, err := r.compileWebhookUrl(metricWebhook.Spec.Webhook, metricWebhook.Namespace, metricWebhook.Spec.Selector)
+	if metricWebhook.Status.Mode == metricsv1alpha1.DryRunMode {
+		return r.recordDryRun(metricWebhook, metricReport, webhookUrls, err)
+	}
+
+	r.reportBroker.Publish(name, metricReport)
+	if err != nil {
+		r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedWithdraw", err.Error())
+		reqLogger.Error(err, "failed to resolve webhook url")
+		return nil
+	}
+	reqLogger.Info("withdrawing metrics",
+		"Spec.Webhook.Url(resolved)", webhookUrls,
+		"metricReport", metricReport,
+	)
+	ctx, cancel := deliveryContext(context.Background(), metricWebhook.Spec.ScrapeInterval.Duration)
+	defer cancel()
+	endpoint := webhookEndpoint(metricWebhook.Spec)
+	for _, result := range r.metricNotificationClient.notifyAll(ctx, name, endpoint, webhookUrls, metricReport) {
+		if result.err != nil {
+			r.eventRecorder.Event(metricWebhook, v1.EventTypeWarning, "FailedWithdraw", result.err.Error())
+			reqLogger.Info("failed to withdraw metrics",
+				"Spec.Webhook.Url(resolved)", result.webhookUrl,
+				"Error", result.err,
+			)
+			continue
+		}
+		observeNotificationsSent(name, metricReport)
+	}
+	r.eventRecorder.Event(metricWebhook, v1.EventTypeNormal, "Withdrawn", metricReport.String())
+	return nil
+}
+
+// withdrawRemovedMetrics withdraws the metrics removed from the spec and drops
+// them from the status, so that they are withdrawn once only
+func (r *MetricWebhookReconciler) withdrawRemovedMetrics(metricWebhook *metricsv1alpha1.MetricWebhook) error {
+	kept := specifiedMetrics(metricWebhook.Spec.Metrics, metricWebhook.Status.Metrics)
+	if len(kept) == len(metricWebhook.Status.Metrics) {
+		return nil
+	}
+	var removed []metricsv1alpha1.MetricStatus
+	for _, metric := range metricWebhook.Status.Metrics {
+		if !containsMetric(kept, metric.MetricName()) {
+			removed = append(removed, metric)
+		}
+	}
+
+	dryRunReport := r.withdraw(metricWebhook, removed)
+	metricWebhook.Status.Metrics = kept
+	return r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+		latest.Status.Metrics = specifiedMetrics(latest.Spec.Metrics, latest.Status.Metrics)
+		if dryRunReport != nil {
+			appendDryRunReports(&latest.Status, *dryRunReport)
+		}
+	})
+}
+
+// switchMode withdraws the alerts delivered in Active mode once the MetricWebhook
+// leaves it, as no Cooldown would be delivered for them afterwards, and records
+// the mode the status is reported in from now on
+func (r *MetricWebhookReconciler) switchMode(metricWebhook *metricsv1alpha1.MetricWebhook) error {
+	mode := metricWebhook.Spec.Mode
+	if metricWebhook.Status.Mode == mode {
+		return nil
+	}
+	if metricWebhook.Status.Mode.IsActive() && !mode.IsActive() {
+		r.withdraw(metricWebhook, metricWebhook.Status.Metrics)
+	}
+
+	metricWebhook.Status.Mode = mode
+	return r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+		latest.Status.Mode = mode
+	})
+}
+
+// specifiedMetrics returns the metric statuses of the metrics in the spec
+func specifiedMetrics(metricSpecs []metricsv1alpha1.MetricSpec, metrics []metricsv1alpha1.MetricStatus) []metricsv1alpha1.MetricStatus {
+	specified := make(map[string]bool)
+	for _, metric := range metricSpecs {
+		specified[metric.MetricName()] = true
+	}
+
+	var kept []metricsv1alpha1.MetricStatus
+	for _, metric := range metrics {
+		if specified[metric.MetricName()] {
+			kept = append(kept, metric)
+		}
+	}
+	return kept
+}
+
+func hasAlertingMetrics(metrics []metricsv1alpha1.MetricStatus) bool {
+	for _, metric := range metrics {
+		if metric.Alerting {
+			return true
+		}
+	}
+	return false
+}
+
+// withdrawnMetrics returns the metric statuses as no longer alerting
+func withdrawnMetrics(metrics []metricsv1alpha1.MetricStatus) []metricsv1alpha1.MetricStatus {
+	withdrawn := make([]metricsv1alpha1.MetricStatus, len(metrics))
+	for i, metric := range metrics {
+		withdrawn[i] = *metric.DeepCopy()
+		withdrawn[i].Alerting = false
+	}
+	return withdrawn
+}
+
+func containsMetric(metrics []metricsv1alpha1.MetricStatus, name string) bool {
+	for _, metric := range metrics {
+		if metric.MetricName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// finalize withdraws the alerting metrics of the MetricWebhook being deleted
+// and removes the finalizer, letting the deletion complete. Alerts are delivered
+// in Active mode only, switchMode has withdrawn them once the mode changed.
+// The withdrawal is recorded in the status before the finalizer is removed, so
+// that finalizing again, e.g. after a conflict, does not withdraw twice.
+func (r *MetricWebhookReconciler) finalize(metricWebhook *metricsv1alpha1.MetricWebhook) error {
+	if !hasFinalizer(metricWebhook) {
+		return nil
+	}
+
+	original := metricWebhook.DeepCopy()
+	metricWebhook.Default()
+	if metricWebhook.Status.Mode.IsActive() && hasAlertingMetrics(metricWebhook.Status.Metrics) {
+		r.withdraw(metricWebhook, metricWebhook.Status.Metrics)
+		err := r.patchStatus(metricWebhook, func(latest *metricsv1alpha1.MetricWebhook) {
+			latest.Status.Metrics = withdrawnMetrics(latest.Status.Metrics)
+		})
+		if err != nil {
+			return err
+		}
+
+		// The status patch has changed the resourceVersion the finalizers are patched against
+		name := types.NamespacedName{Namespace: metricWebhook.Namespace, Name: metricWebhook.Name}
+		original = &metricsv1alpha1.MetricWebhook{}
+		if err := r.apiReader.Get(context.TODO(), name, original); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+
+	var finalizers []string
+	for _, finalizer := range original.Finalizers {
+		if finalizer != metricsv1alpha1.WithdrawFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	finalized := original.DeepCopy()
+	finalized.Finalizers = finalizers
+	return r.patchFinalizers(original, finalized)
+}
+
+// addFinalizer makes sure the MetricWebhook is finalized before deletion
+func (r *MetricWebhookReconciler) addFinalizer(metricWebhook *metricsv1alpha1.MetricWebhook) error {
+	if hasFinalizer(metricWebhook) {
+		return nil
+	}
+	// Patch a copy to keep the defaults of metricWebhook the response would drop
+	patched := metricWebhook.DeepCopy()
+	patched.Finalizers = append(patched.Finalizers, metricsv1alpha1.WithdrawFinalizer)
+	if err := r.patchFinalizers(metricWebhook, patched); err != nil {
+		return err
+	}
+	metricWebhook.Finalizers = patched.Finalizers
+	return nil
+}
+
+// patchFinalizers patches the finalizers of original as they are in patched.
+// Merge patches replace lists as a whole, so the patch carries the
+// resourceVersion of original to fail with a conflict rather than drop the
+// finalizers added by others since original has been read.
+func (r *MetricWebhookReconciler) patchFinalizers(original, patched *metricsv1alpha1.MetricWebhook) error {
+	original = original.DeepCopy()
+	original.ResourceVersion = ""
+	return r.client.Patch(context.TODO(), patched, client.MergeFrom(original))
+}
+
+func hasFinalizer(metricWebhook *metricsv1alpha1.MetricWebhook) bool {
+	for _, finalizer := range metricWebhook.Finalizers {
+		if finalizer == metricsv1alpha1.WithdrawFinalizer {
+			return true
+		}
+	}
+	return false
+}
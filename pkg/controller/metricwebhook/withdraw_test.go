@@ -0,0 +1,123 @@
+package metricwebhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+	configv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/config/v1alpha1"
+	"github.com/wingsofovnia/metrics-webhook/pkg/stream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// finalizingReconciler returns a reconciler of the MetricWebhook being deleted,
+// counting the reports delivered to its webhook
+func finalizingReconciler(t *testing.T, mode metricsv1alpha1.MetricWebhookMode) (*MetricWebhookReconciler, *int32, func()) {
+	t.Helper()
+	var delivered int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&delivered, 1)
+	}))
+
+	utilization := int32(90)
+	deletionTimestamp := metav1.Now()
+	metricWebhook := testMetricWebhook()
+	metricWebhook.DeletionTimestamp = &deletionTimestamp
+	metricWebhook.Finalizers = []string{metricsv1alpha1.WithdrawFinalizer}
+	metricWebhook.Spec.Webhook = metricsv1alpha1.Webhook{Url: server.URL}
+	metricWebhook.Status.Mode = mode
+	metricWebhook.Status.Metrics = []metricsv1alpha1.MetricStatus{{
+		Type:     metricsv1alpha1.ResourceMetricSourceType,
+		Alerting: true,
+		Resource: &metricsv1alpha1.ResourceMetricStatus{
+			Name:                      v1.ResourceCPU,
+			CurrentAverageUtilization: &utilization,
+		},
+	}}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, metricsv1alpha1.SchemeBuilder.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, metricWebhook)
+	return &MetricWebhookReconciler{
+		client:                   client,
+		apiReader:                client,
+		scheme:                   scheme,
+		metricNotificationClient: NewMetricAlertClient(configv1alpha1.DefaultOperatorConfig().Delivery),
+		eventRecorder:            record.NewFakeRecorder(100),
+		reportBroker:             stream.NewDefaultBroker(),
+		logger:                   logf.Log.WithName(ReconcilerName),
+	}, &delivered, server.Close
+}
+
+func testMetricWebhook() *metricsv1alpha1.MetricWebhook {
+	utilization := int32(50)
+	return &metricsv1alpha1.MetricWebhook{
+		ObjectMeta: metav1.ObjectMeta{Name: testWebhook.Name, Namespace: testWebhook.Namespace},
+		Spec: metricsv1alpha1.MetricWebhookSpec{
+			Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+			Metrics: []metricsv1alpha1.MetricSpec{{
+				Type: metricsv1alpha1.ResourceMetricSourceType,
+				Resource: &metricsv1alpha1.ResourceMetricSource{
+					Name:                     v1.ResourceCPU,
+					TargetAverageUtilization: &utilization,
+				},
+			}},
+		},
+	}
+}
+
+func getMetricWebhook(t *testing.T, r *MetricWebhookReconciler, name types.NamespacedName) *metricsv1alpha1.MetricWebhook {
+	t.Helper()
+	metricWebhook := &metricsv1alpha1.MetricWebhook{}
+	require.NoError(t, r.client.Get(context.TODO(), name, metricWebhook))
+	return metricWebhook
+}
+
+func TestFinalize_WithdrawsOnce(t *testing.T) {
+	r, delivered, closeServer := finalizingReconciler(t, metricsv1alpha1.ActiveMode)
+	defer closeServer()
+
+	require.NoError(t, r.finalize(getMetricWebhook(t, r, testWebhook)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(delivered))
+
+	finalized := getMetricWebhook(t, r, testWebhook)
+	assert.False(t, hasFinalizer(finalized))
+	assert.False(t, hasAlertingMetrics(finalized.Status.Metrics), "withdrawal recorded")
+
+	// Finalizing again, as after a conflict removing the finalizer, does not withdraw twice
+	finalized.Finalizers = []string{metricsv1alpha1.WithdrawFinalizer}
+	require.NoError(t, r.client.Update(context.TODO(), finalized))
+	require.NoError(t, r.finalize(getMetricWebhook(t, r, testWebhook)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(delivered))
+	assert.False(t, hasFinalizer(getMetricWebhook(t, r, testWebhook)))
+}
+
+func TestFinalize_NotActive(t *testing.T) {
+	// Nothing has been delivered in DryRun mode, and switchMode has
+	// withdrawn the alerts once the MetricWebhook has been suspended
+	for _, mode := range []metricsv1alpha1.MetricWebhookMode{metricsv1alpha1.DryRunMode, metricsv1alpha1.SuspendedMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			r, delivered, closeServer := finalizingReconciler(t, mode)
+			defer closeServer()
+
+			require.NoError(t, r.finalize(getMetricWebhook(t, r, testWebhook)))
+			assert.Equal(t, int32(0), atomic.LoadInt32(delivered))
+			assert.False(t, hasFinalizer(getMetricWebhook(t, r, testWebhook)))
+		})
+	}
+}
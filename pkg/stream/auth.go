@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+// Authorizer decides whether the bearer token grants access
+// to the reports of the webhooks
+type Authorizer interface {
+	Authorize(token string, webhooks []types.NamespacedName) error
+}
+
+// UnauthenticatedError tells the bearer token is not valid
+type UnauthenticatedError struct {
+	Reason string
+}
+
+func (e *UnauthenticatedError) Error() string {
+	return fmt.Sprintf("unauthenticated: %s", e.Reason)
+}
+
+// ForbiddenError tells the token owner may not access the reports
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("forbidden: %s", e.Reason)
+}
+
+// KubeAuthorizer authenticates bearer tokens with TokenReviews and grants
+// access to the reports of the MetricWebhooks the token owner may get,
+// checked with SubjectAccessReviews
+type KubeAuthorizer struct {
+	clientSet kubernetes.Interface
+}
+
+func NewKubeAuthorizer(clientSet kubernetes.Interface) *KubeAuthorizer {
+	return &KubeAuthorizer{clientSet: clientSet}
+}
+
+func (a *KubeAuthorizer) Authorize(token string, webhooks []types.NamespacedName) error {
+	if token == "" {
+		return &UnauthenticatedError{Reason: "bearer token required"}
+	}
+
+	tokenReview, err := a.clientSet.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to review token: %v", err)
+	}
+	if !tokenReview.Status.Authenticated {
+		return &UnauthenticatedError{Reason: tokenReview.Status.Error}
+	}
+	user := tokenReview.Status.User
+
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+
+	for _, webhook := range webhooks {
+		accessReview, err := a.clientSet.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: webhook.Namespace,
+					Verb:      "get",
+					Group:     metricsv1alpha1.SchemeGroupVersion.Group,
+					Version:   metricsv1alpha1.SchemeGroupVersion.Version,
+					Resource:  "metricwebhooks",
+					Name:      webhook.Name,
+				},
+				User:   user.Username,
+				Groups: user.Groups,
+				UID:    user.UID,
+				Extra:  extra,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to review access to %s: %v", webhook, err)
+		}
+		if !accessReview.Status.Allowed {
+			return &ForbiddenError{Reason: fmt.Sprintf("%s may not get metricwebhook %s", user.Username, webhook)}
+		}
+	}
+	return nil
+}
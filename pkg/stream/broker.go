@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+const defaultBacklogSize = 1024
+const defaultSubscriberBufferSize = 64
+
+// Event is a metric report published to the subscribers of a MetricWebhook
+type Event struct {
+	// ID is unique across operator restarts, see ParseEventID
+	ID      string
+	Webhook types.NamespacedName
+	Report  metricsv1alpha1.MetricReport
+
+	seq uint64
+}
+
+// Broker fans metric reports out to subscribers, keeping a backlog of recent
+// ones so that subscribers may resume after disconnects
+type Broker struct {
+	mu sync.Mutex
+
+	// epoch distinguishes sequences of the operator restarts
+	epoch       int64
+	seq         uint64
+	backlog     []Event
+	backlogSize int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(backlogSize int) *Broker {
+	return &Broker{
+		epoch:       time.Now().UnixNano(),
+		backlogSize: backlogSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+func NewDefaultBroker() *Broker {
+	return NewBroker(defaultBacklogSize)
+}
+
+// Subscription receives events of the MetricWebhooks subscribed to.
+// Events is closed once the subscription is cancelled or the subscriber
+// falls too far behind, the latter requiring to resubscribe.
+type Subscription struct {
+	Events <-chan Event
+
+	events   chan Event
+	webhooks map[types.NamespacedName]bool
+	broker   *Broker
+}
+
+// Cancel stops delivering events to the subscription
+func (s *Subscription) Cancel() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.unsubscribe(s)
+}
+
+// Publish sends the report to the subscribers of the webhook
+func (b *Broker) Publish(webhook types.NamespacedName, report metricsv1alpha1.MetricReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{
+		ID:      fmt.Sprintf("%d-%d", b.epoch, b.seq),
+		Webhook: webhook,
+		Report:  report,
+		seq:     b.seq,
+	}
+
+	b.backlog = append(b.backlog, event)
+	if len(b.backlog) > b.backlogSize {
+		b.backlog = b.backlog[len(b.backlog)-b.backlogSize:]
+	}
+
+	for subscription := range b.subscribers {
+		if !subscription.webhooks[webhook] {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			// Slow subscriber, let it resume from its last event
+			b.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe subscribes to the webhooks. If lastEventID is set, the events
+// published after it are replayed. Complete tells whether all of those are
+// still in the backlog, i.e. no events have been missed.
+func (b *Broker) Subscribe(webhooks []types.NamespacedName, lastEventID string) (subscription *Subscription, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	webhookSet := make(map[types.NamespacedName]bool)
+	for _, webhook := range webhooks {
+		webhookSet[webhook] = true
+	}
+
+	var replay []Event
+	complete = true
+	if lastEventID != "" {
+		epoch, seq, err := ParseEventID(lastEventID)
+		switch {
+		case err != nil || epoch != b.epoch || seq > b.seq:
+			// Events of another operator instance, all of the current ones may have been missed
+			complete = false
+			replay = b.backlog
+		case len(b.backlog) > 0 && seq+1 < b.backlog[0].seq:
+			complete = false
+			replay = b.backlog
+		default:
+			for i, event := range b.backlog {
+				if event.seq > seq {
+					replay = b.backlog[i:]
+					break
+				}
+			}
+		}
+	}
+
+	var missed []Event
+	for _, event := range replay {
+		if webhookSet[event.Webhook] {
+			missed = append(missed, event)
+		}
+	}
+
+	events := make(chan Event, len(missed)+defaultSubscriberBufferSize)
+	for _, event := range missed {
+		events <- event
+	}
+
+	subscription = &Subscription{
+		Events:   events,
+		events:   events,
+		webhooks: webhookSet,
+		broker:   b,
+	}
+	b.subscribers[subscription] = struct{}{}
+	return subscription, complete
+}
+
+func (b *Broker) unsubscribe(subscription *Subscription) {
+	if _, subscribed := b.subscribers[subscription]; subscribed {
+		delete(b.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// ParseEventID parses the event id of the "<epoch>-<sequence>" format
+func ParseEventID(id string) (epoch int64, seq uint64, err error) {
+	tokens := strings.SplitN(id, "-", 2)
+	if len(tokens) != 2 {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	if epoch, err = strconv.ParseInt(tokens[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q: %v", id, err)
+	}
+	if seq, err = strconv.ParseUint(tokens[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q: %v", id, err)
+	}
+	return epoch, seq, nil
+}
@@ -0,0 +1,151 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+var (
+	appWebhook   = types.NamespacedName{Namespace: "default", Name: "app"}
+	otherWebhook = types.NamespacedName{Namespace: "default", Name: "other"}
+)
+
+func testReport(name string) metricsv1alpha1.MetricReport {
+	return metricsv1alpha1.MetricReport{{Type: metricsv1alpha1.Alert, Name: name}}
+}
+
+// received drains the events buffered for the subscription
+func received(subscription *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event, open := <-subscription.Events:
+			if !open {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func reportNames(events []Event) []string {
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Report[0].Name)
+	}
+	return names
+}
+
+func TestBroker_Publish(t *testing.T) {
+	broker := NewBroker(10)
+	subscription, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, "")
+	defer subscription.Cancel()
+	assert.True(t, complete)
+
+	broker.Publish(appWebhook, testReport("cpu"))
+	broker.Publish(otherWebhook, testReport("memory"))
+	broker.Publish(appWebhook, testReport("rps"))
+
+	events := received(subscription)
+	assert.Equal(t, []string{"cpu", "rps"}, reportNames(events))
+	for _, event := range events {
+		assert.Equal(t, appWebhook, event.Webhook)
+		epoch, _, err := ParseEventID(event.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, broker.epoch, epoch)
+	}
+}
+
+func TestBroker_Resume(t *testing.T) {
+	broker := NewBroker(10)
+	first, _ := broker.Subscribe([]types.NamespacedName{appWebhook}, "")
+	broker.Publish(appWebhook, testReport("cpu"))
+	lastEvent := received(first)[0]
+	first.Cancel()
+
+	// Published while disconnected
+	broker.Publish(appWebhook, testReport("memory"))
+	broker.Publish(otherWebhook, testReport("other"))
+	broker.Publish(appWebhook, testReport("rps"))
+
+	resumed, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, lastEvent.ID)
+	defer resumed.Cancel()
+	assert.True(t, complete)
+	assert.Equal(t, []string{"memory", "rps"}, reportNames(received(resumed)))
+
+	// Nothing missed since the latest event
+	broker.Publish(appWebhook, testReport("latest"))
+	latest, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, received(resumed)[0].ID)
+	defer latest.Cancel()
+	assert.True(t, complete)
+	assert.Empty(t, received(latest))
+}
+
+func TestBroker_Gap(t *testing.T) {
+	broker := NewBroker(2)
+	first, _ := broker.Subscribe([]types.NamespacedName{appWebhook}, "")
+	broker.Publish(appWebhook, testReport("cpu"))
+	lastEvent := received(first)[0]
+	first.Cancel()
+
+	// Events after the last one fell out of the backlog
+	for i := 0; i < 3; i++ {
+		broker.Publish(appWebhook, testReport(fmt.Sprintf("report-%d", i)))
+	}
+	subscription, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, lastEvent.ID)
+	defer subscription.Cancel()
+	assert.False(t, complete)
+	assert.Equal(t, []string{"report-1", "report-2"}, reportNames(received(subscription)))
+
+	tests := []struct {
+		name        string
+		lastEventID string
+	}{
+		{name: "another operator instance", lastEventID: fmt.Sprintf("%d-1", broker.epoch-1)},
+		{name: "sequence ahead of the broker", lastEventID: fmt.Sprintf("%d-100", broker.epoch)},
+		{name: "invalid id", lastEventID: "invalid"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscription, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, test.lastEventID)
+			defer subscription.Cancel()
+			assert.False(t, complete)
+			assert.Equal(t, []string{"report-1", "report-2"}, reportNames(received(subscription)))
+		})
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	broker := NewBroker(defaultSubscriberBufferSize * 2)
+	slow, _ := broker.Subscribe([]types.NamespacedName{appWebhook}, "")
+	other, _ := broker.Subscribe([]types.NamespacedName{otherWebhook}, "")
+	defer other.Cancel()
+
+	for i := 0; i <= defaultSubscriberBufferSize; i++ {
+		broker.Publish(appWebhook, testReport(fmt.Sprintf("report-%d", i)))
+	}
+
+	// Dropped once its buffer is full, with the events buffered so far delivered
+	events := received(slow)
+	assert.Len(t, events, defaultSubscriberBufferSize)
+	_, open := <-slow.Events
+	assert.False(t, open)
+	assert.NotContains(t, broker.subscribers, slow)
+	assert.Contains(t, broker.subscribers, other)
+
+	// Resumes from its last event without a gap
+	resumed, complete := broker.Subscribe([]types.NamespacedName{appWebhook}, events[len(events)-1].ID)
+	defer resumed.Cancel()
+	assert.True(t, complete)
+	assert.Equal(t, []string{fmt.Sprintf("report-%d", defaultSubscriberBufferSize)}, reportNames(received(resumed)))
+
+	// Cancelling a dropped subscription is a no-op
+	slow.Cancel()
+}
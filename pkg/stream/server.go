@@ -0,0 +1,181 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	metricsv1alpha1 "github.com/wingsofovnia/metrics-webhook/pkg/apis/metrics/v1alpha1"
+)
+
+const ServerName = "report-stream"
+
+const ReportsPath = "/reports"
+
+// Server-Sent Events types
+const (
+	// ReportEventType events carry a MetricReportEvent
+	ReportEventType = "report"
+	// GapEventType events tell that some reports have been missed since
+	// the last event id, e.g. due to the operator restart
+	GapEventType = "gap"
+)
+
+const defaultHeartbeatInterval = 15 * time.Second
+const defaultShutdownTimeout = 5 * time.Second
+
+// Server streams metric reports published to the broker as Server-Sent Events.
+// Subscribers GET ReportsPath with webhook=<namespace>/<name> query params for
+// each MetricWebhook subscribed to, authorized with a bearer token, and may
+// resume with the Last-Event-ID header (or lastEventId query param).
+type Server struct {
+	addr       string
+	broker     *Broker
+	authorizer Authorizer
+	heartbeat  time.Duration
+	logger     logr.Logger
+}
+
+func NewServer(addr string, broker *Broker, authorizer Authorizer) *Server {
+	return &Server{
+		addr:       addr,
+		broker:     broker,
+		authorizer: authorizer,
+		heartbeat:  defaultHeartbeatInterval,
+		logger:     logf.Log.WithName(ServerName),
+	}
+}
+
+// Start implements manager.Runnable, serving until stop is closed
+func (s *Server) Start(stop <-chan struct{}) error {
+	router := http.NewServeMux()
+	router.Handle(ReportsPath, s)
+	httpServer := &http.Server{
+		Addr:    s.addr,
+		Handler: router,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		s.logger.Info("serving report stream", "addr", s.addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+		defer cancel()
+		// Streams never end on their own, close them rather than wait
+		if err := httpServer.Shutdown(ctx); err != nil {
+			return httpServer.Close()
+		}
+		return nil
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var webhooks []types.NamespacedName
+	for _, param := range r.URL.Query()["webhook"] {
+		tokens := strings.SplitN(param, "/", 2)
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			http.Error(w, fmt.Sprintf("invalid webhook %q, <namespace>/<name> expected", param), http.StatusBadRequest)
+			return
+		}
+		webhooks = append(webhooks, types.NamespacedName{Namespace: tokens[0], Name: tokens[1]})
+	}
+	if len(webhooks) == 0 {
+		http.Error(w, "at least one webhook required", http.StatusBadRequest)
+		return
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		err := &UnauthenticatedError{Reason: "bearer token required"}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if err := s.authorizer.Authorize(token, webhooks); err != nil {
+		switch err.(type) {
+		case *UnauthenticatedError:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case *ForbiddenError:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			s.logger.Error(err, "failed to authorize subscriber")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	subscription, complete := s.broker.Subscribe(webhooks, lastEventID)
+	defer subscription.Cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", GapEventType)
+	}
+	flusher.Flush()
+
+	s.logger.Info("subscriber connected",
+		"webhooks", webhooks,
+		"remoteAddr", r.RemoteAddr,
+		"lastEventId", lastEventID,
+	)
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, open := <-subscription.Events:
+			if !open {
+				// Dropped as a slow subscriber, it resumes on reconnect
+				return
+			}
+			data, err := json.Marshal(metricsv1alpha1.MetricReportEvent{
+				Namespace: event.Webhook.Namespace,
+				Name:      event.Webhook.Name,
+				Report:    event.Report,
+			})
+			if err != nil {
+				s.logger.Error(err, "failed to encode metric report event")
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, ReportEventType, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// tokenAuthorizer authenticates a single token, granting access to all reports
+type tokenAuthorizer string
+
+func (a tokenAuthorizer) Authorize(token string, webhooks []types.NamespacedName) error {
+	if token != string(a) {
+		return &UnauthenticatedError{Reason: "invalid token"}
+	}
+	return nil
+}
+
+func TestServer_Unauthenticated(t *testing.T) {
+	server := NewServer("", NewDefaultBroker(), tokenAuthorizer("secret"))
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{name: "no authorization"},
+		{name: "token without bearer prefix", authorization: "secret"},
+		{name: "basic authorization", authorization: "Basic secret"},
+		{name: "invalid token", authorization: "Bearer other"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", ReportsPath+"?webhook=default/app", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusUnauthorized, res.Code)
+		})
+	}
+}